@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/founderio/autopilot_testbed/elcar"
+	"github.com/founderio/autopilot_testbed/elcar/sim"
+	"github.com/founderio/autopilot_testbed/paths"
+)
+
+// runCommand handles the command line subcommands.
+// Returns false if the arguments do not name a subcommand and the game should start.
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	var err error
+	switch args[0] {
+	case "run":
+		err = runHeadless(args[1:])
+	case "play":
+		return false
+	case "help", "-h", "-help", "--help":
+		printUsage()
+	default:
+		// Flags we don't know are most likely passed by the OS when launching the app
+		if strings.HasPrefix(args[0], "-") {
+			return false
+		}
+		err = fmt.Errorf("unknown command %q", args[0])
+		printUsage()
+	}
+
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err.Error())
+		os.Exit(1)
+	}
+	return true
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, `Usage: autopilot_testbed [command] [flags]
+
+Commands:
+  play   Open the game window (default)
+  run    Simulate a saved car without a window and print a JSON report
+  help   Show this message
+
+Run "autopilot_testbed run -h" for the flags of the run command.`)
+}
+
+func runHeadless(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	carFile := flags.String("car", "", "save file of the car, looked up in the save folder if not found as given")
+	track := flags.String("track", elcar.DefaultTrack, "track to drive on, from the worlds folder of the resources or the save folder")
+	worldFile := flags.String("world", "", "world file to drive in instead of a track")
+	resourceFolder := flags.String("resources", "resources", "folder containing definitions and sprites")
+	seconds := flags.Float64("seconds", 60, "simulated seconds to run")
+	vehicle := flags.String("vehicle", "", "vehicle from the definitions to use instead of the one in the save")
+	traffic := flags.String("traffic", "", "comma separated save files of cars to place at the further spawn points")
+	dynamics := flags.String("dynamics", "", "dynamics model to use instead of the one in the save: "+strings.Join(elcar.DynamicsModelNames(), ", "))
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *carFile == "" {
+		return fmt.Errorf("no car given, use --car")
+	}
+	if *seconds <= 0 {
+		return fmt.Errorf("--seconds must be positive")
+	}
+
+	if *worldFile == "" {
+		*worldFile, err = findTrack(*resourceFolder, *track)
+		if err != nil {
+			return err
+		}
+	}
+
+	s, err := sim.Load(*resourceFolder, *worldFile, findSaveFile(*carFile))
+	if err != nil {
+		return err
+	}
+	if *dynamics != "" {
+		if _, ok := elcar.DynamicsModels[*dynamics]; !ok {
+			return fmt.Errorf("unknown dynamics model %q", *dynamics)
+		}
+		s.Car.Dynamics = *dynamics
+	}
+	if *vehicle != "" {
+		if _, ok := elcar.Definitions.Vehicles[*vehicle]; !ok {
+			return fmt.Errorf("unknown vehicle %q, available: %s", *vehicle, strings.Join(elcar.VehicleNames(), ", "))
+		}
+		s.Car.Vehicle = *vehicle
+	}
+	if *traffic != "" {
+		for _, trafficFile := range strings.Split(*traffic, ",") {
+			err = s.AddTraffic(findSaveFile(strings.TrimSpace(trafficFile)))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Step at the physics rate so every physics tick is accounted for in the report
+	dt := 1 / elcar.PhysicsTickRate
+	s.Run(int(math.Ceil(*seconds/dt)), dt)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s.Report())
+}
+
+// findTrack returns the world file of the track with the given name
+func findTrack(resourceFolder, name string) (string, error) {
+	tracks, err := elcar.FindTracks(filepath.Join(resourceFolder, elcar.WorldFolder), filepath.Join(paths.GetDataPath(), elcar.WorldFolder))
+	if err != nil {
+		return "", err
+	}
+	filename, ok := tracks[name]
+	if !ok {
+		return "", fmt.Errorf("unknown track %q, available: %s", name, strings.Join(elcar.TrackNames(tracks), ", "))
+	}
+	return filename, nil
+}
+
+// findSaveFile resolves bare save file names like "save_2.toml" against the save folder
+func findSaveFile(filename string) string {
+	if filepath.IsAbs(filename) {
+		return filename
+	}
+	if _, err := os.Stat(filename); err == nil {
+		return filename
+	}
+	return filepath.Join(paths.GetDataPath(), filename)
+}
@@ -28,9 +28,31 @@ const (
 	CTypeRadar           = "radar"
 	CTypeRadarShortrange = "radar_shortrange"
 	CTypeRoadSensor      = "road_sensor"
+	CTypeBumpSensor      = "bump_sensor"
+	CTypeVehicleSensor   = "vehicle_sensor"
+	CTypeLidar           = "lidar"
+	CTypeCamera          = "camera"
+	CTypeSpeedometer     = "speedometer"
+	CTypeCompass         = "compass"
+	CTypeGyroscope       = "gyroscope"
+	CTypePositionSensor  = "position_sensor"
+	CTypeGPS             = "gps"
 	CTypeConstant        = "constant"
 	CTypeSplitSignal     = "split_signal"
 	CTypeCompareEquals   = "compare_equals"
+	CTypePID             = "pid"
+	CTypeIntegrator      = "integrator"
+	CTypeDifferentiator  = "differentiator"
+	CTypeDelay           = "delay"
+	CTypeSampleHold      = "sample_hold"
+	CTypeMin             = "min"
+	CTypeMax             = "max"
+	CTypeAbs             = "abs"
+	CTypeInvert          = "invert"
+	CTypeClamp           = "clamp"
+	CTypeSchmittTrigger  = "schmitt_trigger"
+	CTypeDivide          = "divide"
+	CTypeMux             = "mux"
 )
 
 var (
@@ -38,6 +60,16 @@ var (
 	SpriteDefinitions SpriteDefs
 )
 
+var (
+	// ElectronicsTickRate is the number of times per second the components of a car are evaluated
+	ElectronicsTickRate float64 = 50
+	// PhysicsTickRate is the number of times per second car movement and collision are integrated
+	PhysicsTickRate float64 = 120
+)
+
+// Longest frame time a single call to World.Update will simulate, longer ones are truncated
+const MaxUpdateTime = 0.25
+
 var ComponentMakerFuncs = map[string]func() Component{
 	CTypeBuiltinSteering: func() Component {
 		return &BuiltinSteering{}
@@ -67,6 +99,45 @@ var ComponentMakerFuncs = map[string]func() Component{
 	CTypeCompareEquals: func() Component {
 		return &CompareEquals{}
 	},
+	CTypePID: func() Component {
+		return &PID{}
+	},
+	CTypeIntegrator: func() Component {
+		return &Integrator{}
+	},
+	CTypeDifferentiator: func() Component {
+		return &Differentiator{}
+	},
+	CTypeDelay: func() Component {
+		return &Delay{}
+	},
+	CTypeSampleHold: func() Component {
+		return &SampleHold{}
+	},
+	CTypeMin: func() Component {
+		return &Min{}
+	},
+	CTypeMax: func() Component {
+		return &Max{}
+	},
+	CTypeAbs: func() Component {
+		return &Abs{}
+	},
+	CTypeInvert: func() Component {
+		return &Invert{}
+	},
+	CTypeClamp: func() Component {
+		return &Clamp{}
+	},
+	CTypeSchmittTrigger: func() Component {
+		return &SchmittTrigger{}
+	},
+	CTypeDivide: func() Component {
+		return &Divide{}
+	},
+	CTypeMux: func() Component {
+		return &Mux{}
+	},
 	CTypeRadar: func() Component {
 		return &Radar{}
 	},
@@ -76,6 +147,33 @@ var ComponentMakerFuncs = map[string]func() Component{
 	CTypeRoadSensor: func() Component {
 		return &RoadSensor{}
 	},
+	CTypeBumpSensor: func() Component {
+		return &BumpSensor{}
+	},
+	CTypeVehicleSensor: func() Component {
+		return &VehicleSensor{}
+	},
+	CTypeLidar: func() Component {
+		return &Lidar{}
+	},
+	CTypeCamera: func() Component {
+		return &Camera{}
+	},
+	CTypeSpeedometer: func() Component {
+		return &Speedometer{}
+	},
+	CTypeCompass: func() Component {
+		return &Compass{}
+	},
+	CTypeGyroscope: func() Component {
+		return &Gyroscope{}
+	},
+	CTypePositionSensor: func() Component {
+		return &PositionSensor{}
+	},
+	CTypeGPS: func() Component {
+		return &GPS{}
+	},
 }
 
 func absDistance(a, b pixel.Vec) float64 {
@@ -86,19 +184,80 @@ type Car struct {
 	Position pixel.Vec
 	Rotation float64
 	Speed    float64
+	// Sideways speed while sliding, to the left of the car
+	LateralSpeed float64
+	// Radians per second the car turned in the last physics step, positive to the right
+	YawRate float64
+
+	// Name of the DynamicsModel moving the car
+	Dynamics string
+	// Name of the vehicle in the definitions, providing speed, handling and size
+	Vehicle string
+	// Name of the chassis in the definitions, providing the hood layout
+	Chassis string
 
 	Steering     float64
 	Acceleration float64
 	Braking      float64
 
+	// Simulated seconds since the last reset
+	Time float64
+
+	// Number of times the car ran into an obstacle since the last reset
+	Collisions      int
+	CollisionEvents []CollisionEvent
+	// Obstacles overlapped by the pose tried in the last physics step
+	Contacts []Contact
+	// Car.Time of the last contact with each obstacle, to tell new impacts from sliding along
+	lastContact map[obstacle]float64
+
+	// Checkpoints and laps passed since the last reset
+	Progress LapProgress
+	// Poses since the start of the current lap and of the lap completed last, nil before the first lap
+	CurrentLap Ghost
+	LastLap    *Ghost
+
 	Components  []UsedComponent
 	DebugPoints []pixel.Vec
 	DebugLines  []pixel.Line
 }
 
+// Reset places the car at the given position and clears all movement and component state
+func (c *Car) Reset(position pixel.Vec, rotation float64) {
+	c.Position = position
+	c.Rotation = rotation
+	c.Speed = 0
+	c.LateralSpeed = 0
+	c.YawRate = 0
+
+	c.Steering = 0
+	c.Acceleration = 0
+	c.Braking = 0
+
+	c.Time = 0
+	c.Collisions = 0
+	c.CollisionEvents = nil
+	c.Contacts = nil
+	c.lastContact = nil
+	c.Progress.Reset()
+	c.CurrentLap = Ghost{TickRate: PhysicsTickRate}
+	c.LastLap = nil
+
+	c.ResetComponentState()
+}
+
+// RestartLap drops the progress through the current lap and the lap times,
+// so laps driven with different settings are not compared with each other.
+func (c *Car) RestartLap() {
+	c.Progress.Reset()
+	c.Progress.LapStart = c.Time
+	c.CurrentLap = Ghost{TickRate: PhysicsTickRate}
+	c.LastLap = nil
+}
+
 func (c *Car) ResetComponentState() {
-	for _, component := range c.Components {
-		component.State = ComponentMakerFuncs[component.TypeName]()
+	for i, component := range c.Components {
+		c.Components[i].State = ComponentMakerFuncs[component.TypeName]()
 	}
 }
 
@@ -124,13 +283,10 @@ func (c *Car) AddComponent(id int, typeName string) {
 		if component.ID == id {
 			component.TypeName = typeName
 			component.State = ComponentMakerFuncs[typeName]()
+			component.Parameters = def.DefaultParameters()
 
-			// Ensure the connections are initialized and NOT connected to anything (-1)
-			component.ConnectedOutputs = make([]ComponentDestination, len(def.OutputPins))
-			for i, o := range component.ConnectedOutputs {
-				o.ID = -1
-				component.ConnectedOutputs[i] = o
-			}
+			// Ensure the connections are initialized and NOT connected to anything
+			component.ConnectedOutputs = make([][]ComponentDestination, len(def.OutputPins))
 
 			c.Components[i] = component
 			return
@@ -140,16 +296,30 @@ func (c *Car) AddComponent(id int, typeName string) {
 		ID:               id,
 		TypeName:         typeName,
 		State:            ComponentMakerFuncs[typeName](),
-		ConnectedOutputs: make([]ComponentDestination, len(def.OutputPins)),
-	}
-	// Ensure the connections are initialized and NOT connected to anything (-1)
-	for i, o := range component.ConnectedOutputs {
-		o.ID = -1
-		component.ConnectedOutputs[i] = o
+		ConnectedOutputs: make([][]ComponentDestination, len(def.OutputPins)),
+		Parameters:       def.DefaultParameters(),
 	}
 	c.Components = append(c.Components, component)
 }
 
+// SetParameter changes a parameter of a placed component, limited to the range allowed by its definition
+func (c *Car) SetParameter(id int, name string, value float64) {
+	for i, component := range c.Components {
+		if component.ID == id {
+			param, ok := Definitions.Components[component.TypeName].GetParameter(name)
+			if !ok {
+				return
+			}
+			if component.Parameters == nil {
+				component.Parameters = make(map[string]float64)
+			}
+			component.Parameters[name] = param.Clamp(value)
+			c.Components[i] = component
+			return
+		}
+	}
+}
+
 func (c *Car) RemoveComponent(id int) {
 	for i, component := range c.Components {
 		if component.ID == id {
@@ -159,7 +329,13 @@ func (c *Car) RemoveComponent(id int) {
 	}
 }
 
+// ConnectPorts adds a wire from an output pin to an input pin.
+// An output pin can drive any number of inputs.
 func (c *Car) ConnectPorts(id, pin, targetID, targetPin int) {
+	if c.IsConnected(id, pin, targetID, targetPin) {
+		return
+	}
+
 	for i, component := range c.Components {
 		if component.ID == id {
 
@@ -167,10 +343,10 @@ func (c *Car) ConnectPorts(id, pin, targetID, targetPin int) {
 				return
 			}
 
-			component.ConnectedOutputs[pin] = ComponentDestination{
+			component.ConnectedOutputs[pin] = append(component.ConnectedOutputs[pin], ComponentDestination{
 				ID:  targetID,
 				Pin: targetPin,
-			}
+			})
 			c.Components[i] = component
 
 			return
@@ -178,115 +354,160 @@ func (c *Car) ConnectPorts(id, pin, targetID, targetPin int) {
 	}
 }
 
-func (c *Car) Forward() pixel.Vec {
-	return pixel.Unit(-c.Rotation)
-}
-
-func (c *Car) Update(dt float64, background pixel.PictureColor, world *World) {
-	// Update electronics
-	//TODO: Electronics should update on separate tick
-	{
-		// Clear debug points, they will be filled with each update
-		c.DebugPoints = make([]pixel.Vec, 0)
-		c.DebugLines = make([]pixel.Line, 0)
-
-		outputValues := make([]OutputValue, 0, len(c.Components)*3)
-		for _, component := range c.Components {
-			destinations := component.ConnectedOutputs
-			values := component.State.GetOutputs()
-			count := len(destinations)
-			if len(values) < count {
-				count = len(values)
-			}
+// DisconnectPorts removes a single wire from an output pin to an input pin
+func (c *Car) DisconnectPorts(id, pin, targetID, targetPin int) {
+	for i, component := range c.Components {
+		if component.ID == id {
 
-			for i := 0; i < count; i++ {
-				outputValues = append(outputValues, OutputValue{
-					DestinationComponent: destinations[i],
-					Value:                values[i],
-				})
+			if pin < 0 || pin >= len(component.ConnectedOutputs) {
+				return
 			}
-		}
 
-		for _, component := range c.Components {
-			if component.ID < 0 || component.ID >= len(Definitions.Ports) {
-				continue
+			destinations := component.ConnectedOutputs[pin]
+			for j, dest := range destinations {
+				if dest.ID == targetID && dest.Pin == targetPin {
+					component.ConnectedOutputs[pin] = append(destinations[:j], destinations[j+1:]...)
+					break
+				}
 			}
-			port := Definitions.Ports[component.ID]
-			def := Definitions.Components[component.TypeName]
+			c.Components[i] = component
 
-			inputs, connected := calculateComponentInputs(component.ID, len(def.InputPins), outputValues)
-			component.State.SetInputs(inputs, connected)
-			component.State.Update(c, background, world, port)
+			return
 		}
 	}
+}
 
-	// Apply current movement changes and collision
-	{
-		const acceleration = 3
-		const maxSpeed = 15
+func (c *Car) IsConnected(id, pin, targetID, targetPin int) bool {
+	component := c.GetComponent(id)
+	if pin < 0 || pin >= len(component.ConnectedOutputs) {
+		return false
+	}
+	for _, dest := range component.ConnectedOutputs[pin] {
+		if dest.ID == targetID && dest.Pin == targetPin {
+			return true
+		}
+	}
+	return false
+}
 
-		const steerRate = math.Pi / 4
+// VehicleDefinition returns the parameters of the car's vehicle, or of the default vehicle if it is unknown
+func (c *Car) VehicleDefinition() VehicleDefinition {
+	def, ok := Definitions.Vehicles[c.Vehicle]
+	if !ok {
+		return Definitions.Vehicles[DefaultVehicle]
+	}
+	return def
+}
 
-		c.Rotation += c.Steering * steerRate * dt
+// ChassisDefinition returns the hood layout of the car, or of the default chassis if it is unknown
+func (c *Car) ChassisDefinition() ChassisDefinition {
+	def, ok := Definitions.Chassis[c.Chassis]
+	if !ok {
+		return Definitions.Chassis[DefaultChassis]
+	}
+	return def
+}
 
-		c.Speed += c.Acceleration * acceleration * dt
-		if c.Speed > maxSpeed {
-			c.Speed = maxSpeed
-		}
-		c.Speed -= c.Braking * acceleration * dt
-		if c.Speed < 0 {
-			c.Speed = 0
-		}
+// Ports returns the component slots of the car's chassis
+func (c *Car) Ports() []PortDefinition {
+	return c.ChassisDefinition().Ports
+}
 
-		dir := c.Forward().Scaled(c.Speed * dt)
-		newPosition := c.Position.Add(dir)
-		if c.collidesWhenMovedTo(newPosition, world) {
-			c.Speed = 0
-		} else {
-			c.Position = newPosition
+// AddPrefilledComponents places the components every design on the chassis starts with
+func (c *Car) AddPrefilledComponents() {
+	for idx, port := range c.Ports() {
+		if port.Prefill != "" {
+			c.AddComponent(idx, port.Prefill)
 		}
 	}
-
 }
 
-func (c *Car) collidesWhenMovedTo(pos pixel.Vec, world *World) bool {
+func (c *Car) Forward() pixel.Vec {
+	return pixel.Unit(-c.Rotation)
+}
 
-	carWidth := float64(10)
+func (c *Car) updateElectronics(dt float64, background pixel.PictureColor, world *World) {
+	// Clear debug points, they will be filled with each update
+	c.DebugPoints = make([]pixel.Vec, 0)
+	c.DebugLines = make([]pixel.Line, 0)
 
-	// Stop at world border to contain the car
-	if !world.Bounds().Contains(pos) {
-		return true
-	}
-	for _, edge := range world.Bounds().Edges() {
-		closestOnLine := edge.Closest(pos)
-		if absDistance(closestOnLine, pos) < carWidth {
-			return true
+	outputValues := make([]OutputValue, 0, len(c.Components)*3)
+	for _, component := range c.Components {
+		destinations := component.ConnectedOutputs
+		values := component.State.GetOutputs()
+		count := len(destinations)
+		if len(values) < count {
+			count = len(values)
 		}
-	}
 
-	for _, o := range world.Walls {
-		for _, edge := range o.Bounds().Edges() {
-			closestOnLine := edge.Closest(pos)
-			if absDistance(closestOnLine, pos) < carWidth {
-				return true
+		for i := 0; i < count; i++ {
+			for _, destination := range destinations[i] {
+				outputValues = append(outputValues, OutputValue{
+					DestinationComponent: destination,
+					Value:                values[i],
+				})
 			}
 		}
 	}
 
-	for _, o := range world.Props {
-		def, ok := SpriteDefinitions.Props[o.Name]
-		if !ok {
+	ports := c.Ports()
+	for _, component := range c.Components {
+		if component.ID < 0 || component.ID >= len(ports) {
 			continue
 		}
+		port := ports[component.ID]
+		def := Definitions.Components[component.TypeName]
 
-		for _, edge := range o.Bounds(def).Edges() {
-			closestOnLine := edge.Closest(pos)
-			if absDistance(closestOnLine, pos) < carWidth {
-				return true
-			}
+		if parameterized, ok := component.State.(ParameterizedComponent); ok {
+			parameterized.SetParameters(component.Parameters)
 		}
+
+		inputs, connected := calculateComponentInputs(component.ID, len(def.InputPins), outputValues)
+		component.State.SetInputs(inputs, connected)
+		component.State.Update(dt, c, background, world, port)
+	}
+}
+
+func (c *Car) updatePhysics(dt float64, world *World) {
+	vehicle := c.VehicleDefinition()
+	previousPosition := c.Position
+	previousRotation := c.Rotation
+	newPosition, newRotation := getDynamicsModel(c.Dynamics).Step(c, vehicle, dt)
+	c.Time += dt
+
+	// The rotation is checked as well, turning on the spot can hit obstacles too
+	c.Contacts = c.contactsAt(newPosition, newRotation, vehicle, world)
+
+	solidity := 0.0
+	blocked := false
+	for _, contact := range c.Contacts {
+		if contact.Surface.Solidity >= 1 {
+			blocked = true
+		} else {
+			solidity = math.Max(solidity, contact.Surface.Solidity)
+		}
+	}
+
+	if blocked {
+		c.collide(newPosition, newRotation, vehicle, world)
+	} else {
+		c.Position = newPosition
+		c.Rotation = newRotation
+	}
+	c.YawRate = (c.Rotation - previousRotation) / dt
+	c.CurrentLap.Record(c)
+	if c.Progress.update(previousPosition, c.Position, c.Time, world.Checkpoints) {
+		lap := c.CurrentLap
+		c.LastLap = &lap
+		c.CurrentLap = Ghost{TickRate: PhysicsTickRate}
+	}
+
+	// Soft barriers take away this fraction of the speed per second, sliding included
+	if solidity > 0 {
+		remaining := math.Pow(1-solidity, dt)
+		c.Speed *= remaining
+		c.LateralSpeed *= remaining
 	}
-	return false
 }
 
 func calculateComponentInputs(id int, inputCount int, outputValues []OutputValue) ([]float64, []bool) {
@@ -301,11 +522,15 @@ func calculateComponentInputs(id int, inputCount int, outputValues []OutputValue
 			continue
 		}
 
-		inputs[value.DestinationComponent.Pin] = maxValue(
-			inputs[value.DestinationComponent.Pin],
-			value.Value,
-		)
-		connected[value.DestinationComponent.Pin] = true
+		// Several outputs connected to the same pin provide the largest of their values.
+		// The first one seeds the pin, so negative values pass through.
+		pin := value.DestinationComponent.Pin
+		if connected[pin] {
+			inputs[pin] = maxValue(inputs[pin], value.Value)
+		} else {
+			inputs[pin] = value.Value
+		}
+		connected[pin] = true
 	}
 	return inputs, connected
 }
@@ -330,7 +555,8 @@ type InputValue struct {
 type UsedComponent struct {
 	ID               int
 	TypeName         string
-	ConnectedOutputs []ComponentDestination
+	ConnectedOutputs [][]ComponentDestination
+	Parameters       map[string]float64
 	State            Component
 }
 
@@ -340,10 +566,17 @@ type ComponentDestination struct {
 }
 
 type Component interface {
-	Update(car *Car, background pixel.PictureColor, world *World, port PortDefinition)
+	// Update is called once per electronics tick, dt is the tick duration in seconds
+	Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition)
 
 	GetDebugState() string
 
 	SetInputs(values []float64, connected []bool)
 	GetOutputs() []float64
 }
+
+// ParameterizedComponent is implemented by components with parameters in their definition.
+// SetParameters receives a value for every defined parameter before each update.
+type ParameterizedComponent interface {
+	SetParameters(values map[string]float64)
+}
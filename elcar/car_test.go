@@ -0,0 +1,95 @@
+package elcar
+
+import (
+	"math"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+func TestCalculateComponentInputs(t *testing.T) {
+	output := func(id, pin int, value float64) OutputValue {
+		return OutputValue{
+			DestinationComponent: ComponentDestination{ID: id, Pin: pin},
+			Value:                value,
+		}
+	}
+	outputs := []OutputValue{
+		// A single negative value passes through
+		output(1, 0, -0.5),
+		// Several outputs on one pin provide the largest value, even if all are negative
+		output(1, 1, -0.75),
+		output(1, 1, -0.25),
+		output(1, 2, -1),
+		output(1, 2, 0.5),
+		// Other components and pins out of range are ignored
+		output(2, 0, 1),
+		output(1, 5, 1),
+	}
+
+	inputs, connected := calculateComponentInputs(1, 4, outputs)
+	wantInputs := []float64{-0.5, -0.25, 0.5, 0}
+	wantConnected := []bool{true, true, true, false}
+	for pin := range wantInputs {
+		if inputs[pin] != wantInputs[pin] || connected[pin] != wantConnected[pin] {
+			t.Errorf("pin %d: got %g connected %v, want %g connected %v",
+				pin, inputs[pin], connected[pin], wantInputs[pin], wantConnected[pin])
+		}
+	}
+}
+
+// Saves from before negative signals were passed on may feed negative values into the builtins.
+// The car has to drive just like back then, when those values arrived as 0.
+func TestBuiltinsIgnoreNegativeInputs(t *testing.T) {
+	car := &Car{}
+
+	steering := ComponentMakerFuncs[CTypeBuiltinSteering]()
+	steering.SetInputs([]float64{-1, 0.5}, []bool{true, true})
+	steering.Update(1/ElectronicsTickRate, car, nil, nil, PortDefinition{})
+	if car.Steering != 0.5 {
+		t.Errorf("steering: got %g, want 0.5", car.Steering)
+	}
+
+	acceleration := ComponentMakerFuncs[CTypeBuiltinAcceleration]()
+	acceleration.SetInputs([]float64{-1}, []bool{true})
+	acceleration.Update(1/ElectronicsTickRate, car, nil, nil, PortDefinition{})
+	if car.Acceleration != 0 {
+		t.Errorf("acceleration: got %g, want 0", car.Acceleration)
+	}
+
+	braking := ComponentMakerFuncs[CTypeBuiltinBraking]()
+	braking.SetInputs([]float64{-1}, []bool{true})
+	braking.Update(1/ElectronicsTickRate, car, nil, nil, PortDefinition{})
+	if car.Braking != 0 {
+		t.Errorf("braking: got %g, want 0", car.Braking)
+	}
+}
+
+func TestSoftSurfaceSlowsPerSecond(t *testing.T) {
+	defer func(old Defs) { Definitions = old }(Definitions)
+	Definitions.Vehicles = map[string]VehicleDefinition{
+		DefaultVehicle: {Acceleration: 3, MaxSpeed: 15, Length: 12, Width: 6, Wheelbase: 8, MaxSteerAngle: 0.5},
+	}
+
+	world := &World{
+		Size: pixel.V(1000, 1000),
+		Walls: []Wall{
+			{Pos: pixel.V(100, 100), Size: pixel.V(800, 800), Solidity: 0.5},
+		},
+	}
+	car := &Car{
+		Dynamics:     DynamicsBicycle,
+		Position:     pixel.V(500, 500),
+		Speed:        10,
+		LateralSpeed: 4,
+	}
+	world.Cars = []*Car{car}
+
+	// Without grip the slide is only slowed by the surface
+	for i := 0; i < int(PhysicsTickRate); i++ {
+		car.updatePhysics(1/PhysicsTickRate, world)
+	}
+	if math.Abs(car.Speed-5) > 1e-9 || math.Abs(car.LateralSpeed-2) > 1e-9 {
+		t.Errorf("after one second: speed %g lateral %g, want 5 and 2", car.Speed, car.LateralSpeed)
+	}
+}
@@ -0,0 +1,83 @@
+package elcar
+
+import (
+	"github.com/faiface/pixel"
+)
+
+// SpawnPoint is a pose cars are placed at when the world is reset
+type SpawnPoint struct {
+	Pos      pixel.Vec
+	Rotation float64
+}
+
+// Checkpoint is a line across the track the car has to pass.
+// Seen from a car driving the right way, A is on the right and B on the left.
+type Checkpoint struct {
+	A pixel.Vec
+	B pixel.Vec
+}
+
+func (c Checkpoint) Line() pixel.Line {
+	return pixel.L(c.A, c.B)
+}
+
+// Forward returns the direction the checkpoint has to be passed in
+func (c Checkpoint) Forward() pixel.Vec {
+	return c.A.To(c.B).Normal().Scaled(-1).Unit()
+}
+
+// LapProgress follows a car through the checkpoints of the world.
+// The checkpoints have to be passed in order, the last one is the finish line.
+type LapProgress struct {
+	// Index of the checkpoint passed last in the current lap, -1 if none yet
+	LastCheckpoint int
+	// Completed laps and their durations in seconds
+	Laps     int
+	LapTimes []float64
+	// Car.Time the current lap started at
+	LapStart float64
+}
+
+func (p *LapProgress) Reset() {
+	p.LastCheckpoint = -1
+	p.Laps = 0
+	p.LapTimes = nil
+	p.LapStart = 0
+}
+
+// BestLap returns the shortest lap time, or 0 if no lap was completed yet
+func (p *LapProgress) BestLap() float64 {
+	best := 0.0
+	for _, lapTime := range p.LapTimes {
+		if best == 0 || lapTime < best {
+			best = lapTime
+		}
+	}
+	return best
+}
+
+// update checks if the car passed the next checkpoint in its forward direction while moving
+// between the two positions. Returns true if that completed a lap.
+func (p *LapProgress) update(from, to pixel.Vec, time float64, checkpoints []Checkpoint) bool {
+	if len(checkpoints) == 0 || from == to {
+		return false
+	}
+	next := p.LastCheckpoint + 1
+	if _, ok := pixel.L(from, to).Intersect(checkpoints[next].Line()); !ok {
+		return false
+	}
+	// Driving backwards over the line doesn't count
+	if from.To(to).Dot(checkpoints[next].Forward()) <= 0 {
+		return false
+	}
+
+	if next < len(checkpoints)-1 {
+		p.LastCheckpoint = next
+		return false
+	}
+	p.Laps++
+	p.LapTimes = append(p.LapTimes, time-p.LapStart)
+	p.LapStart = time
+	p.LastCheckpoint = -1
+	return true
+}
@@ -0,0 +1,65 @@
+package elcar
+
+import (
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+// Track around the origin driven counterclockwise, with a checkpoint on each side
+var testCheckpoints = []Checkpoint{
+	{A: pixel.V(110, 0), B: pixel.V(90, 0)},
+	{A: pixel.V(0, 110), B: pixel.V(0, 90)},
+	{A: pixel.V(-110, 0), B: pixel.V(-90, 0)},
+	{A: pixel.V(0, -110), B: pixel.V(0, -90)},
+}
+
+// Moves across each of the test checkpoints in the driving direction
+var testForwardMoves = [][2]pixel.Vec{
+	{pixel.V(100, -5), pixel.V(100, 5)},
+	{pixel.V(5, 100), pixel.V(-5, 100)},
+	{pixel.V(-100, 5), pixel.V(-100, -5)},
+	{pixel.V(-5, -100), pixel.V(5, -100)},
+}
+
+func TestLapProgress(t *testing.T) {
+	var progress LapProgress
+	progress.Reset()
+	for i, move := range testForwardMoves {
+		completed := progress.update(move[0], move[1], float64(i+1), testCheckpoints)
+		last := i == len(testCheckpoints)-1
+		if completed != last {
+			t.Errorf("checkpoint %d: lap completed %v", i, completed)
+		}
+		if !last && progress.LastCheckpoint != i {
+			t.Errorf("checkpoint %d: last checkpoint %d", i, progress.LastCheckpoint)
+		}
+	}
+	if progress.Laps != 1 || len(progress.LapTimes) != 1 || progress.LapTimes[0] != 4 {
+		t.Errorf("got %d laps with times %v, want 1 lap of 4s", progress.Laps, progress.LapTimes)
+	}
+}
+
+func TestLapProgressIgnoresReverseCrossing(t *testing.T) {
+	reverse := func(move [2]pixel.Vec) (pixel.Vec, pixel.Vec) {
+		return move[1], move[0]
+	}
+
+	var progress LapProgress
+	progress.Reset()
+	for i, move := range testForwardMoves {
+		from, to := reverse(move)
+		if progress.update(from, to, 1, testCheckpoints) || progress.LastCheckpoint != -1 {
+			t.Fatalf("reverse crossing of checkpoint %d counted", i)
+		}
+	}
+
+	// Passing all but the finish line, then backing over it
+	for _, move := range testForwardMoves[:len(testForwardMoves)-1] {
+		progress.update(move[0], move[1], 2, testCheckpoints)
+	}
+	from, to := reverse(testForwardMoves[len(testForwardMoves)-1])
+	if progress.update(from, to, 3, testCheckpoints) || progress.Laps != 0 {
+		t.Errorf("reverse crossing of the finish line completed a lap")
+	}
+}
@@ -0,0 +1,314 @@
+package elcar
+
+import (
+	"math"
+
+	"github.com/faiface/pixel"
+)
+
+// Contact describes the overlap of the car with an obstacle
+type Contact struct {
+	// Unit vector pointing from the obstacle towards the car
+	Normal pixel.Vec
+	// Distance the car has to move along Normal to no longer overlap
+	Depth float64
+
+	Kind    HitKind
+	Index   int
+	Surface Surface
+}
+
+// CollisionEvent is recorded when the car runs into a solid obstacle
+type CollisionEvent struct {
+	// Car.Time of the impact
+	Time     float64
+	Position pixel.Vec
+	// Speed towards the obstacle just before the impact
+	ImpactSpeed float64
+	// Unit vector pointing from the obstacle towards the car
+	Normal pixel.Vec
+
+	Kind    HitKind
+	Index   int
+	Surface Surface
+}
+
+// obstacle identifies a wall, prop, moving prop, car or the world bounds
+type obstacle struct {
+	Kind  HitKind
+	Index int
+}
+
+// Contacts with the same obstacle closer together than this count as a single collision
+const collisionDebounce = 0.5
+
+// Number of attempts to push the car out of overlapping obstacles before giving up
+const collisionIterations = 4
+
+// orientedBox is a rectangle rotated around its center
+type orientedBox struct {
+	Center pixel.Vec
+	// Unit vectors along the length and the width of the box
+	Axes [2]pixel.Vec
+	// Half of the length and width
+	HalfSize pixel.Vec
+}
+
+// carBox returns the collision box of a car with the given pose
+func carBox(position pixel.Vec, rotation float64, vehicle VehicleDefinition) orientedBox {
+	return orientedBox{
+		Center:   position,
+		Axes:     [2]pixel.Vec{pixel.Unit(-rotation), pixel.Unit(-rotation + math.Pi/2)},
+		HalfSize: pixel.V(vehicle.Length/2, vehicle.Width/2),
+	}
+}
+
+func (b orientedBox) Corners() [4]pixel.Vec {
+	length := b.Axes[0].Scaled(b.HalfSize.X)
+	width := b.Axes[1].Scaled(b.HalfSize.Y)
+	return [4]pixel.Vec{
+		b.Center.Add(length).Add(width),
+		b.Center.Add(length).Sub(width),
+		b.Center.Sub(length).Sub(width),
+		b.Center.Sub(length).Add(width),
+	}
+}
+
+// Bounds returns the axis aligned rectangle containing the box
+func (b orientedBox) Bounds() pixel.Rect {
+	extent := pixel.V(
+		b.HalfSize.X*math.Abs(b.Axes[0].X)+b.HalfSize.Y*math.Abs(b.Axes[1].X),
+		b.HalfSize.X*math.Abs(b.Axes[0].Y)+b.HalfSize.Y*math.Abs(b.Axes[1].Y),
+	)
+	return pixel.Rect{Min: b.Center.Sub(extent), Max: b.Center.Add(extent)}
+}
+
+// radius returns half the length of the projection of the box onto the axis
+func (b orientedBox) radius(axis pixel.Vec) float64 {
+	return b.HalfSize.X*math.Abs(b.Axes[0].Dot(axis)) + b.HalfSize.Y*math.Abs(b.Axes[1].Dot(axis))
+}
+
+func (b orientedBox) Edges() [4]pixel.Line {
+	corners := b.Corners()
+	return [4]pixel.Line{
+		pixel.L(corners[0], corners[1]),
+		pixel.L(corners[1], corners[2]),
+		pixel.L(corners[2], corners[3]),
+		pixel.L(corners[3], corners[0]),
+	}
+}
+
+// ClosestPoint returns the point inside or on the edge of the box that is closest to v
+func (b orientedBox) ClosestPoint(v pixel.Vec) pixel.Vec {
+	offset := v.Sub(b.Center)
+	along := math.Max(-b.HalfSize.X, math.Min(b.HalfSize.X, offset.Dot(b.Axes[0])))
+	across := math.Max(-b.HalfSize.Y, math.Min(b.HalfSize.Y, offset.Dot(b.Axes[1])))
+	return b.Center.Add(b.Axes[0].Scaled(along)).Add(b.Axes[1].Scaled(across))
+}
+
+// OverlapRect tests the box against an axis aligned rectangle
+func (b orientedBox) OverlapRect(rect pixel.Rect) (normal pixel.Vec, depth float64, ok bool) {
+	rect = rect.Norm()
+	return b.Overlap(orientedBox{
+		Center:   rect.Center(),
+		Axes:     [2]pixel.Vec{pixel.V(1, 0), pixel.V(0, 1)},
+		HalfSize: rect.Size().Scaled(0.5),
+	})
+}
+
+// Overlap tests two boxes with the separating axis theorem.
+// Returns the normal pointing from the other box towards this one and the penetration depth.
+func (b orientedBox) Overlap(other orientedBox) (normal pixel.Vec, depth float64, ok bool) {
+	offset := b.Center.Sub(other.Center)
+
+	depth = math.Inf(1)
+	axes := [4]pixel.Vec{other.Axes[0], other.Axes[1], b.Axes[0], b.Axes[1]}
+	for _, axis := range axes {
+		distance := offset.Dot(axis)
+		overlap := b.radius(axis) + other.radius(axis) - math.Abs(distance)
+		if overlap <= 0 {
+			return pixel.ZV, 0, false
+		}
+		if overlap < depth {
+			depth = overlap
+			normal = axis
+			if distance < 0 {
+				normal = axis.Scaled(-1)
+			}
+		}
+	}
+	return normal, depth, true
+}
+
+// OutsideOf returns how far the box sticks out of the area.
+// The normal points back into the area, across the edge with the largest overshoot.
+func (b orientedBox) OutsideOf(area pixel.Rect) (normal pixel.Vec, depth float64, ok bool) {
+	area = area.Norm()
+	for _, corner := range b.Corners() {
+		check := func(overshoot float64, inwards pixel.Vec) {
+			if overshoot > depth {
+				depth = overshoot
+				normal = inwards
+				ok = true
+			}
+		}
+		check(area.Min.X-corner.X, pixel.V(1, 0))
+		check(corner.X-area.Max.X, pixel.V(-1, 0))
+		check(area.Min.Y-corner.Y, pixel.V(0, 1))
+		check(corner.Y-area.Max.Y, pixel.V(0, -1))
+	}
+	return
+}
+
+// contactsAt returns all obstacles the car would overlap with the given pose
+func (c *Car) contactsAt(position pixel.Vec, rotation float64, vehicle VehicleDefinition, world *World) []Contact {
+	box := carBox(position, rotation, vehicle)
+	var contacts []Contact
+
+	// Stop at world border to contain the car
+	if normal, depth, ok := box.OutsideOf(world.Bounds()); ok {
+		contacts = append(contacts, Contact{
+			Normal:  normal,
+			Depth:   depth,
+			Kind:    HitBounds,
+			Index:   0,
+			Surface: boundsSurface,
+		})
+	}
+
+	world.spatialIndex().Query(box.Bounds(), func(o indexedObject) {
+		if o.Surface.Solidity <= 0 {
+			return
+		}
+		if normal, depth, ok := box.OverlapRect(o.Bounds); ok {
+			contacts = append(contacts, Contact{
+				Normal:  normal,
+				Depth:   depth,
+				Kind:    o.Kind,
+				Index:   o.Index,
+				Surface: o.Surface,
+			})
+		}
+	})
+
+	// Moving props would have to be re-indexed every step
+	world.eachMovingProp(func(index int, bounds pixel.Rect, surface Surface) {
+		if surface.Solidity <= 0 {
+			return
+		}
+		if normal, depth, ok := box.OverlapRect(bounds); ok {
+			contacts = append(contacts, Contact{
+				Normal:  normal,
+				Depth:   depth,
+				Kind:    HitMovingProp,
+				Index:   index,
+				Surface: surface,
+			})
+		}
+	})
+
+	// Other cars are few and always moving, so they are not part of the spatial index
+	for i, other := range world.Cars {
+		if other == c {
+			continue
+		}
+		if normal, depth, ok := box.Overlap(other.box()); ok {
+			contacts = append(contacts, Contact{
+				Normal:  normal,
+				Depth:   depth,
+				Kind:    HitCar,
+				Index:   i,
+				Surface: carSurface,
+			})
+		}
+	}
+	return contacts
+}
+
+// box returns the collision box of the car at its current pose
+func (c *Car) box() orientedBox {
+	return carBox(c.Position, c.Rotation, c.VehicleDefinition())
+}
+
+// collide moves the car to the given pose, which overlaps solid obstacles.
+// The car is pushed out of the obstacles and slides along them, losing more speed the more
+// head-on the impact is. If it can't be pushed out, it stays where it is and stops.
+func (c *Car) collide(position pixel.Vec, rotation float64, vehicle VehicleDefinition, world *World) {
+	velocity := pixel.Unit(-rotation).Scaled(c.Speed).Add(pixel.Unit(-rotation + math.Pi/2).Scaled(c.LateralSpeed))
+
+	for _, contact := range c.Contacts {
+		if contact.Surface.Solidity < 1 {
+			continue
+		}
+		// Negative while moving into the obstacle
+		normalSpeed := velocity.Dot(contact.Normal)
+		c.recordContact(contact, math.Max(0, -normalSpeed))
+
+		if normalSpeed < 0 {
+			// 0 when grazing the obstacle, 1 when hitting it head-on
+			impactAngle := math.Asin(math.Min(1, -normalSpeed/velocity.Len())) / (math.Pi / 2)
+			velocity = velocity.Sub(contact.Normal.Scaled(normalSpeed)).Scaled(1 - impactAngle)
+		}
+	}
+
+	// Glancing blows turn the car along the surface, so it keeps sliding instead of running into it again
+	if velocity.Len() > 0 {
+		turn := normalizeAngle(-velocity.Angle() - rotation)
+		if math.Abs(turn) < math.Pi/4 {
+			rotation += turn
+		}
+	}
+	forward := pixel.Unit(-rotation)
+	left := pixel.Unit(-rotation + math.Pi/2)
+
+	for i := 0; i < collisionIterations; i++ {
+		var deepest *Contact
+		for _, contact := range c.contactsAt(position, rotation, vehicle, world) {
+			contact := contact
+			if contact.Surface.Solidity >= 1 && (deepest == nil || contact.Depth > deepest.Depth) {
+				deepest = &contact
+			}
+		}
+		if deepest == nil {
+			c.Position = position
+			c.Rotation = rotation
+			c.Speed = math.Max(0, velocity.Dot(forward))
+			c.LateralSpeed = velocity.Dot(left)
+			return
+		}
+		// Leave a little gap so the next step does not start out touching
+		position = position.Add(deepest.Normal.Scaled(deepest.Depth + 0.01))
+	}
+
+	c.Speed = 0
+	c.LateralSpeed = 0
+}
+
+// normalizeAngle wraps the angle to the range -Pi to Pi
+func normalizeAngle(angle float64) float64 {
+	return math.Remainder(angle, 2*math.Pi)
+}
+
+// recordContact adds a collision event, unless the car was already touching the obstacle
+func (c *Car) recordContact(contact Contact, impactSpeed float64) {
+	if c.lastContact == nil {
+		c.lastContact = make(map[obstacle]float64)
+	}
+	key := obstacle{Kind: contact.Kind, Index: contact.Index}
+	last, touched := c.lastContact[key]
+	c.lastContact[key] = c.Time
+	if touched && c.Time-last < collisionDebounce {
+		return
+	}
+
+	c.Collisions++
+	c.CollisionEvents = append(c.CollisionEvents, CollisionEvent{
+		Time:        c.Time,
+		Position:    c.Position,
+		ImpactSpeed: impactSpeed,
+		Normal:      contact.Normal,
+		Kind:        contact.Kind,
+		Index:       contact.Index,
+		Surface:     contact.Surface,
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"strconv"
+	"strings"
 
 	"github.com/faiface/pixel"
 )
@@ -12,7 +13,7 @@ type BuiltinSteering struct {
 	steerLeft, steerRight float64
 }
 
-func (c *BuiltinSteering) Update(car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+func (c *BuiltinSteering) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
 	car.Steering = c.steerRight - c.steerLeft
 }
 func (c *BuiltinSteering) GetDebugState() string {
@@ -20,7 +21,8 @@ func (c *BuiltinSteering) GetDebugState() string {
 }
 
 func (c *BuiltinSteering) SetInputs(values []float64, connected []bool) {
-	c.steerLeft, c.steerRight = values[0], values[1]
+	// Negative values would steer the other way
+	c.steerLeft, c.steerRight = math.Max(0, values[0]), math.Max(0, values[1])
 }
 func (c *BuiltinSteering) GetOutputs() []float64 {
 	return []float64{}
@@ -30,7 +32,7 @@ type BuiltinAcceleration struct {
 	acceleration float64
 }
 
-func (c *BuiltinAcceleration) Update(car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+func (c *BuiltinAcceleration) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
 	car.Acceleration = c.acceleration
 }
 func (c *BuiltinAcceleration) GetDebugState() string {
@@ -38,7 +40,8 @@ func (c *BuiltinAcceleration) GetDebugState() string {
 }
 
 func (c *BuiltinAcceleration) SetInputs(values []float64, connected []bool) {
-	c.acceleration = values[0]
+	// Negative acceleration is left to the brakes
+	c.acceleration = math.Max(0, values[0])
 }
 func (c *BuiltinAcceleration) GetOutputs() []float64 {
 	return []float64{}
@@ -48,7 +51,7 @@ type BuiltinBraking struct {
 	braking float64
 }
 
-func (c *BuiltinBraking) Update(car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+func (c *BuiltinBraking) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
 	car.Braking = c.braking
 }
 func (c *BuiltinBraking) GetDebugState() string {
@@ -56,7 +59,8 @@ func (c *BuiltinBraking) GetDebugState() string {
 }
 
 func (c *BuiltinBraking) SetInputs(values []float64, connected []bool) {
-	c.braking = values[0]
+	// Negative braking would accelerate past the top speed
+	c.braking = math.Max(0, values[0])
 }
 func (c *BuiltinBraking) GetOutputs() []float64 {
 	return []float64{}
@@ -67,7 +71,7 @@ type CompareEquals struct {
 	value float64
 }
 
-func (c *CompareEquals) Update(car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+func (c *CompareEquals) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
 	absDiff := math.Abs(c.a - c.b)
 	if absDiff < 0.5 {
 		c.value = (0.5 - absDiff) * 2
@@ -91,7 +95,7 @@ type Subtract struct {
 	value float64
 }
 
-func (c *Subtract) Update(car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+func (c *Subtract) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
 	c.value = c.a - c.b
 }
 func (c *Subtract) GetDebugState() string {
@@ -110,7 +114,7 @@ type Add struct {
 	value  float64
 }
 
-func (c *Add) Update(car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+func (c *Add) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
 	var newValue float64
 	for _, val := range c.inputs {
 		newValue += val
@@ -134,7 +138,7 @@ type Multiply struct {
 	value     float64
 }
 
-func (c *Multiply) Update(car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+func (c *Multiply) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
 	var newValue float64 = 1
 	for i, val := range c.inputs {
 		if c.connected[i] {
@@ -155,20 +159,421 @@ func (c *Multiply) GetOutputs() []float64 {
 	return []float64{c.value}
 }
 
+// PID is a proportional-integral-derivative controller driving the
+// measurement towards the setpoint.
+type PID struct {
+	setpoint, measurement float64
+	kp, ki, kd            float64
+	outputMin, outputMax  float64
+
+	integral  float64
+	lastError float64
+	started   bool
+
+	value float64
+}
+
+func (c *PID) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+	err := c.setpoint - c.measurement
+
+	// No derivative kick on the first update
+	derivative := 0.0
+	if c.started {
+		derivative = (err - c.lastError) / dt
+	}
+	c.lastError = err
+	c.started = true
+
+	integral := c.integral + err*dt
+	output := c.kp*err + c.ki*integral + c.kd*derivative
+
+	// Anti-windup: stop integrating while the output is saturated in the direction of the error
+	if output > c.outputMax {
+		output = c.outputMax
+		if err > 0 {
+			integral = c.integral
+		}
+	} else if output < c.outputMin {
+		output = c.outputMin
+		if err < 0 {
+			integral = c.integral
+		}
+	}
+	c.integral = integral
+	c.value = output
+}
+func (c *PID) GetDebugState() string {
+	return strconv.FormatFloat(c.value, 'g', 3, 64)
+}
+
+func (c *PID) SetParameters(values map[string]float64) {
+	c.kp, c.ki, c.kd = values["Kp"], values["Ki"], values["Kd"]
+	c.outputMin, c.outputMax = values["Min"], values["Max"]
+}
+
+func (c *PID) SetInputs(values []float64, connected []bool) {
+	c.setpoint, c.measurement = values[0], values[1]
+}
+func (c *PID) GetOutputs() []float64 {
+	return []float64{c.value}
+}
+
+// Integrator sums up its input over time, a signal on the reset pin clears it
+type Integrator struct {
+	input, reset float64
+	gain, limit  float64
+	value        float64
+}
+
+func (c *Integrator) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+	if c.reset > 0.5 {
+		c.value = 0
+		return
+	}
+	c.value = math.Max(-c.limit, math.Min(c.limit, c.value+c.input*c.gain*dt))
+}
+func (c *Integrator) GetDebugState() string {
+	return strconv.FormatFloat(c.value, 'g', 3, 64)
+}
+
+func (c *Integrator) SetParameters(values map[string]float64) {
+	c.gain, c.limit = values["Gain"], values["Limit"]
+}
+
+func (c *Integrator) SetInputs(values []float64, connected []bool) {
+	c.input, c.reset = values[0], values[1]
+}
+func (c *Integrator) GetOutputs() []float64 {
+	return []float64{c.value}
+}
+
+// Differentiator provides the rate of change of its input per second
+type Differentiator struct {
+	input     float64
+	gain      float64
+	lastInput float64
+	started   bool
+	value     float64
+}
+
+func (c *Differentiator) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+	if c.started {
+		c.value = (c.input - c.lastInput) / dt * c.gain
+	}
+	c.lastInput = c.input
+	c.started = true
+}
+func (c *Differentiator) GetDebugState() string {
+	return strconv.FormatFloat(c.value, 'g', 3, 64)
+}
+
+func (c *Differentiator) SetParameters(values map[string]float64) {
+	c.gain = values["Gain"]
+}
+
+func (c *Differentiator) SetInputs(values []float64, connected []bool) {
+	c.input = values[0]
+}
+func (c *Differentiator) GetOutputs() []float64 {
+	return []float64{c.value}
+}
+
+// Delay outputs its input from a configurable number of ticks ago
+type Delay struct {
+	input  float64
+	ticks  int
+	buffer []float64
+	value  float64
+}
+
+func (c *Delay) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+	c.buffer = append(c.buffer, c.input)
+	if len(c.buffer) > c.ticks {
+		c.value = c.buffer[len(c.buffer)-c.ticks-1]
+		c.buffer = c.buffer[len(c.buffer)-c.ticks:]
+	}
+}
+func (c *Delay) GetDebugState() string {
+	return strconv.FormatFloat(c.value, 'g', 3, 64)
+}
+
+func (c *Delay) SetParameters(values map[string]float64) {
+	c.ticks = int(values["Ticks"])
+}
+
+func (c *Delay) SetInputs(values []float64, connected []bool) {
+	c.input = values[0]
+}
+func (c *Delay) GetOutputs() []float64 {
+	return []float64{c.value}
+}
+
+// SampleHold follows its input while the trigger is high and keeps the last value while it is low
+type SampleHold struct {
+	input, trigger float64
+	value          float64
+}
+
+func (c *SampleHold) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+	if c.trigger > 0.5 {
+		c.value = c.input
+	}
+}
+func (c *SampleHold) GetDebugState() string {
+	return strconv.FormatFloat(c.value, 'g', 3, 64)
+}
+
+func (c *SampleHold) SetInputs(values []float64, connected []bool) {
+	c.input, c.trigger = values[0], values[1]
+}
+func (c *SampleHold) GetOutputs() []float64 {
+	return []float64{c.value}
+}
+
+// Min provides the smallest of the connected inputs
+type Min struct {
+	inputs    []float64
+	connected []bool
+	value     float64
+}
+
+func (c *Min) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+	newValue := math.Inf(1)
+	for i, val := range c.inputs {
+		if c.connected[i] {
+			newValue = math.Min(newValue, val)
+		}
+	}
+	if math.IsInf(newValue, 1) {
+		newValue = 0
+	}
+	c.value = newValue
+}
+func (c *Min) GetDebugState() string {
+	return strconv.FormatFloat(c.value, 'g', 3, 64)
+}
+
+func (c *Min) SetInputs(values []float64, connected []bool) {
+	c.inputs = values
+	c.connected = connected
+}
+func (c *Min) GetOutputs() []float64 {
+	return []float64{c.value}
+}
+
+// Max provides the largest of the connected inputs
+type Max struct {
+	inputs    []float64
+	connected []bool
+	value     float64
+}
+
+func (c *Max) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+	newValue := math.Inf(-1)
+	for i, val := range c.inputs {
+		if c.connected[i] {
+			newValue = math.Max(newValue, val)
+		}
+	}
+	if math.IsInf(newValue, -1) {
+		newValue = 0
+	}
+	c.value = newValue
+}
+func (c *Max) GetDebugState() string {
+	return strconv.FormatFloat(c.value, 'g', 3, 64)
+}
+
+func (c *Max) SetInputs(values []float64, connected []bool) {
+	c.inputs = values
+	c.connected = connected
+}
+func (c *Max) GetOutputs() []float64 {
+	return []float64{c.value}
+}
+
+// Abs provides the absolute value of its input
+type Abs struct {
+	input float64
+	value float64
+}
+
+func (c *Abs) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+	c.value = math.Abs(c.input)
+}
+func (c *Abs) GetDebugState() string {
+	return strconv.FormatFloat(c.value, 'g', 3, 64)
+}
+
+func (c *Abs) SetInputs(values []float64, connected []bool) {
+	c.input = values[0]
+}
+func (c *Abs) GetOutputs() []float64 {
+	return []float64{c.value}
+}
+
+// Invert provides 1 minus its input, turning 0..1 signals around
+type Invert struct {
+	input float64
+	value float64
+}
+
+func (c *Invert) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+	c.value = 1 - c.input
+}
+func (c *Invert) GetDebugState() string {
+	return strconv.FormatFloat(c.value, 'g', 3, 64)
+}
+
+func (c *Invert) SetInputs(values []float64, connected []bool) {
+	c.input = values[0]
+}
+func (c *Invert) GetOutputs() []float64 {
+	return []float64{c.value}
+}
+
+// Clamp limits its input to a configurable range
+type Clamp struct {
+	input    float64
+	min, max float64
+	value    float64
+}
+
+func (c *Clamp) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+	c.value = math.Max(c.min, math.Min(c.max, c.input))
+}
+func (c *Clamp) GetDebugState() string {
+	return strconv.FormatFloat(c.value, 'g', 3, 64)
+}
+
+func (c *Clamp) SetParameters(values map[string]float64) {
+	c.min, c.max = values["Min"], values["Max"]
+	if c.max < c.min {
+		c.min, c.max = c.max, c.min
+	}
+}
+
+func (c *Clamp) SetInputs(values []float64, connected []bool) {
+	c.input = values[0]
+}
+func (c *Clamp) GetOutputs() []float64 {
+	return []float64{c.value}
+}
+
+// SchmittTrigger switches its output to 1 once the input rises above the upper threshold
+// and back to 0 once it falls below the lower one, so a noisy input does not make it flicker.
+type SchmittTrigger struct {
+	input     float64
+	high, low float64
+	value     float64
+}
+
+func (c *SchmittTrigger) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+	if c.input > c.high {
+		c.value = 1
+	} else if c.input < c.low {
+		c.value = 0
+	}
+}
+func (c *SchmittTrigger) GetDebugState() string {
+	return strconv.FormatFloat(c.value, 'g', 3, 64)
+}
+
+func (c *SchmittTrigger) SetParameters(values map[string]float64) {
+	c.high, c.low = values["High"], values["Low"]
+	if c.high < c.low {
+		c.high, c.low = c.low, c.high
+	}
+}
+
+func (c *SchmittTrigger) SetInputs(values []float64, connected []bool) {
+	c.input = values[0]
+}
+func (c *SchmittTrigger) GetOutputs() []float64 {
+	return []float64{c.value}
+}
+
+// Divide divides the upper pin by the lower pin.
+// The result is limited to a configurable value, which is also provided with the sign of the dividend when dividing by 0.
+type Divide struct {
+	dividend, divisor float64
+	limit             float64
+	value             float64
+}
+
+func (c *Divide) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+	if c.divisor == 0 {
+		if c.dividend == 0 {
+			c.value = 0
+		} else {
+			c.value = math.Copysign(c.limit, c.dividend)
+		}
+		return
+	}
+	c.value = math.Max(-c.limit, math.Min(c.limit, c.dividend/c.divisor))
+}
+func (c *Divide) GetDebugState() string {
+	return strconv.FormatFloat(c.value, 'g', 3, 64)
+}
+
+func (c *Divide) SetParameters(values map[string]float64) {
+	c.limit = values["Limit"]
+}
+
+func (c *Divide) SetInputs(values []float64, connected []bool) {
+	c.dividend, c.divisor = values[0], values[1]
+}
+func (c *Divide) GetOutputs() []float64 {
+	return []float64{c.value}
+}
+
+// Mux passes on the upper pin while the select pin is low and the middle pin while it is high
+type Mux struct {
+	a, b, selected float64
+	value          float64
+}
+
+func (c *Mux) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+	if c.selected > 0.5 {
+		c.value = c.b
+	} else {
+		c.value = c.a
+	}
+}
+func (c *Mux) GetDebugState() string {
+	return strconv.FormatFloat(c.value, 'g', 3, 64)
+}
+
+func (c *Mux) SetInputs(values []float64, connected []bool) {
+	c.a, c.b, c.selected = values[0], values[1], values[2]
+}
+func (c *Mux) GetOutputs() []float64 {
+	return []float64{c.value}
+}
+
 type ConstantValue struct {
+	values []float64
 }
 
 func (c *ConstantValue) GetDebugState() string {
-	return "0.5, 1.0, 2.0"
+	text := make([]string, len(c.values))
+	for i, value := range c.values {
+		text[i] = strconv.FormatFloat(value, 'g', 3, 64)
+	}
+	return strings.Join(text, ", ")
+}
+
+func (c *ConstantValue) SetParameters(values map[string]float64) {
+	c.values = []float64{values["Top"], values["Middle"], values["Bottom"]}
 }
 
-func (c *ConstantValue) Update(car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+func (c *ConstantValue) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
 }
 
 func (c *ConstantValue) SetInputs(values []float64, connected []bool) {
 }
 func (c *ConstantValue) GetOutputs() []float64 {
-	return []float64{0.5, 1.0, 2.0}
+	return c.values
 }
 
 type SplitSignal struct {
@@ -179,7 +584,7 @@ func (c *SplitSignal) GetDebugState() string {
 	return strconv.FormatFloat(c.input, 'g', 3, 64)
 }
 
-func (c *SplitSignal) Update(car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+func (c *SplitSignal) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
 }
 
 func (c *SplitSignal) SetInputs(values []float64, connected []bool) {
@@ -189,102 +594,165 @@ func (c *SplitSignal) GetOutputs() []float64 {
 	return []float64{c.input, c.input, c.input}
 }
 
-func castLine(world *World, line pixel.Line, maxDistance float64) (float64, pixel.Vec) {
-	closestPoint := line.B
-	closestDistance := maxDistance
+type HitKind int
 
-	intersections := world.Bounds().IntersectionPoints(line)
-	for _, intersectionPoint := range intersections {
-		dist := absDistance(intersectionPoint, line.A)
-		if dist < closestDistance {
-			closestDistance = dist
-			closestPoint = intersectionPoint
-		}
-	}
+const (
+	HitNothing HitKind = iota
+	HitBounds
+	HitWall
+	HitProp
+	HitCar
+	HitMovingProp
+)
 
-	for _, o := range world.Walls {
-		intersections := o.Bounds().IntersectionPoints(line)
-		for _, intersectionPoint := range intersections {
-			dist := absDistance(intersectionPoint, line.A)
-			if dist < closestDistance {
-				closestDistance = dist
-				closestPoint = intersectionPoint
-			}
-		}
+func (k HitKind) String() string {
+	switch k {
+	case HitBounds:
+		return "bounds"
+	case HitWall:
+		return "wall"
+	case HitProp:
+		return "prop"
+	case HitCar:
+		return "car"
+	case HitMovingProp:
+		return "moving_prop"
 	}
+	return "nothing"
+}
 
-	for _, o := range world.Props {
-		def, ok := SpriteDefinitions.Props[o.Name]
-		if !ok {
-			continue
-		}
+// Hit describes the closest object found by a line or circle cast
+type Hit struct {
+	Distance float64
+	Point    pixel.Vec
 
-		intersections := o.Bounds(def).IntersectionPoints(line)
-		for _, intersectionPoint := range intersections {
-			dist := absDistance(intersectionPoint, line.A)
-			if dist < closestDistance {
-				closestDistance = dist
-				closestPoint = intersectionPoint
-			}
-		}
-	}
+	Kind HitKind
+	// Index into World.Walls, World.Props, World.MovingProps or World.Cars, depending on Kind
+	Index   int
+	Surface Surface
+}
 
-	return closestDistance, closestPoint
+// transparentToLight lets light pass through objects that don't reflect it
+func transparentToLight(surface Surface) bool {
+	return surface.ReflectivenessLight <= 0
 }
 
-func castCircle(world *World, circle pixel.Circle, direction pixel.Vec, maxDistance float64) (float64, pixel.Vec) {
-	closestDistance := maxDistance
-	closestPoint := circle.Center.Add(direction.Scaled(maxDistance))
+// transparentToRadar lets radar beams pass through objects that don't reflect them
+func transparentToRadar(surface Surface) bool {
+	return surface.ReflectivenessRadar <= 0
+}
 
-	for _, line := range world.Bounds().Edges() {
-		intersects := circle.IntersectLine(line)
-		if intersects != pixel.ZV {
-			intersectionPoint := line.Closest(circle.Center)
+// castLine finds the closest object intersecting the line.
+// Objects for which ignore returns true are passed through, ignore may be nil.
+// Cars other than self are hit as well.
+func castLine(world *World, line pixel.Line, maxDistance float64, ignore func(Surface) bool, self *Car) Hit {
+	closest := Hit{
+		Distance: maxDistance,
+		Point:    line.B,
+	}
 
-			dist := absDistance(intersectionPoint, circle.Center)
-			if dist < closestDistance {
-				closestDistance = dist
-				closestPoint = intersectionPoint
+	consider := func(intersectionPoint pixel.Vec, kind HitKind, index int, surface Surface) {
+		dist := absDistance(intersectionPoint, line.A)
+		if dist < closest.Distance {
+			closest = Hit{
+				Distance: dist,
+				Point:    intersectionPoint,
+				Kind:     kind,
+				Index:    index,
+				Surface:  surface,
 			}
 		}
 	}
 
-	for _, o := range world.Walls {
-		for _, line := range o.Bounds().Edges() {
-			intersects := circle.IntersectLine(line)
-			if intersects != pixel.ZV {
-				intersectionPoint := line.Closest(circle.Center)
+	check := func(rect pixel.Rect, kind HitKind, index int, surface Surface) {
+		if ignore != nil && ignore(surface) {
+			return
+		}
+		for _, intersectionPoint := range rect.IntersectionPoints(line) {
+			consider(intersectionPoint, kind, index, surface)
+		}
+	}
 
-				dist := absDistance(intersectionPoint, circle.Center)
-				if dist < closestDistance {
-					closestDistance = dist
-					closestPoint = intersectionPoint
+	check(world.Bounds(), HitBounds, 0, boundsSurface)
+
+	world.spatialIndex().Query(pixel.R(line.A.X, line.A.Y, line.B.X, line.B.Y), func(o indexedObject) {
+		check(o.Bounds, o.Kind, o.Index, o.Surface)
+	})
+	world.eachMovingProp(func(index int, bounds pixel.Rect, surface Surface) {
+		check(bounds, HitMovingProp, index, surface)
+	})
+
+	if ignore == nil || !ignore(carSurface) {
+		for i, other := range world.Cars {
+			if other == self {
+				continue
+			}
+			for _, edge := range other.box().Edges() {
+				if intersectionPoint, ok := line.Intersect(edge); ok {
+					consider(intersectionPoint, HitCar, i, carSurface)
 				}
 			}
 		}
 	}
 
-	for _, o := range world.Props {
-		def, ok := SpriteDefinitions.Props[o.Name]
-		if !ok {
-			continue
-		}
+	return closest
+}
 
-		for _, line := range o.Bounds(def).Edges() {
+// castCircle finds the closest object edge within the circle.
+// Objects for which ignore returns true are passed through, ignore may be nil.
+// Cars other than self are hit as well.
+func castCircle(world *World, circle pixel.Circle, direction pixel.Vec, maxDistance float64, ignore func(Surface) bool, self *Car) Hit {
+	closest := Hit{
+		Distance: maxDistance,
+		Point:    circle.Center.Add(direction.Scaled(maxDistance)),
+	}
+
+	checkEdges := func(edges [4]pixel.Line, kind HitKind, index int, surface Surface) {
+		if ignore != nil && ignore(surface) {
+			return
+		}
+		for _, line := range edges {
 			intersects := circle.IntersectLine(line)
 			if intersects != pixel.ZV {
 				intersectionPoint := line.Closest(circle.Center)
 
 				dist := absDistance(intersectionPoint, circle.Center)
-				if dist < closestDistance {
-					closestDistance = dist
-					closestPoint = intersectionPoint
+				if dist < closest.Distance {
+					closest = Hit{
+						Distance: dist,
+						Point:    intersectionPoint,
+						Kind:     kind,
+						Index:    index,
+						Surface:  surface,
+					}
 				}
 			}
 		}
 	}
+	check := func(rect pixel.Rect, kind HitKind, index int, surface Surface) {
+		checkEdges(rect.Edges(), kind, index, surface)
+	}
+
+	check(world.Bounds(), HitBounds, 0, boundsSurface)
+
+	area := pixel.Rect{
+		Min: circle.Center.Sub(pixel.V(circle.Radius, circle.Radius)),
+		Max: circle.Center.Add(pixel.V(circle.Radius, circle.Radius)),
+	}
+	world.spatialIndex().Query(area, func(o indexedObject) {
+		check(o.Bounds, o.Kind, o.Index, o.Surface)
+	})
+	world.eachMovingProp(func(index int, bounds pixel.Rect, surface Surface) {
+		check(bounds, HitMovingProp, index, surface)
+	})
+
+	for i, other := range world.Cars {
+		if other != self {
+			checkEdges(other.box().Edges(), HitCar, i, carSurface)
+		}
+	}
 
-	return closestDistance, closestPoint
+	return closest
 }
 
 type Radar struct {
@@ -295,7 +763,7 @@ func (c *Radar) GetDebugState() string {
 	return strconv.FormatFloat(c.value, 'g', 3, 64)
 }
 
-func (c *Radar) Update(car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+func (c *Radar) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
 	beamLength := float64(50)
 	shortBeamLength := float64(10)
 	beamStart := port.WorldPosition.Rotated(-car.Rotation).Add(car.Position)
@@ -309,18 +777,18 @@ func (c *Radar) Update(car *Car, background pixel.PictureColor, world *World, po
 	}
 
 	// Long-distance check, linecast
-	closestDistance, closestPoint := castLine(world, checkLine, beamLength)
+	closest := castLine(world, checkLine, beamLength, transparentToRadar, car)
 
 	// Check in circle directly around the sensor
-	circleDistance, circlePoint := castCircle(world, beamCircle, beamDirection, shortBeamLength)
-	if circleDistance < closestDistance &&
-		circleDistance < (shortBeamLength-0.001) {
-		closestDistance = circleDistance
-		closestPoint = circlePoint
+	circleHit := castCircle(world, beamCircle, beamDirection, shortBeamLength, transparentToRadar, car)
+	if circleHit.Distance < closest.Distance &&
+		circleHit.Distance < (shortBeamLength-0.001) {
+		closest = circleHit
 	}
 
-	car.DebugLines = append(car.DebugLines, pixel.L(beamStart, closestPoint))
-	c.value = 1 - closestDistance/beamLength
+	car.DebugLines = append(car.DebugLines, pixel.L(beamStart, closest.Point))
+	// Weakly reflecting surfaces return a weaker signal
+	c.value = (1 - closest.Distance/beamLength) * closest.Surface.ReflectivenessRadar
 }
 
 func (c *Radar) SetInputs(values []float64, connected []bool) {
@@ -337,7 +805,7 @@ func (c *RadarShortrange) GetDebugState() string {
 	return strconv.FormatFloat(c.value, 'g', 3, 64)
 }
 
-func (c *RadarShortrange) Update(car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+func (c *RadarShortrange) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
 	beamLength := float64(10)
 	beamStart := port.WorldPosition.Rotated(-car.Rotation).Add(car.Position)
 	beamDirection := port.Direction.Rotated(-car.Rotation).Unit()
@@ -346,10 +814,10 @@ func (c *RadarShortrange) Update(car *Car, background pixel.PictureColor, world
 		Radius: beamLength,
 	}
 
-	closestDistance, closestPoint := castCircle(world, beamCircle, beamDirection, beamLength)
+	closest := castCircle(world, beamCircle, beamDirection, beamLength, transparentToRadar, car)
 
-	car.DebugLines = append(car.DebugLines, pixel.L(beamStart, closestPoint))
-	c.value = 1 - closestDistance/beamLength
+	car.DebugLines = append(car.DebugLines, pixel.L(beamStart, closest.Point))
+	c.value = (1 - closest.Distance/beamLength) * closest.Surface.ReflectivenessRadar
 }
 
 func (c *RadarShortrange) SetInputs(values []float64, connected []bool) {
@@ -358,6 +826,14 @@ func (c *RadarShortrange) GetOutputs() []float64 {
 	return []float64{c.value}
 }
 
+// Brightness is the perceived brightness of a ground color, as seen by the road sensor
+func Brightness(color pixel.RGBA) float64 {
+	return math.Sqrt(
+		0.299*math.Pow(color.R, 2) +
+			0.587*math.Pow(color.G, 2) +
+			0.114*math.Pow(color.B, 2))
+}
+
 type RoadSensor struct {
 	value float64
 }
@@ -366,7 +842,7 @@ func (c *RoadSensor) GetDebugState() string {
 	return strconv.FormatFloat(c.value, 'g', 3, 64)
 }
 
-func (c *RoadSensor) Update(car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+func (c *RoadSensor) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
 	beamLength := float64(15)
 	beamStart := port.WorldPosition.Rotated(-car.Rotation).Add(car.Position)
 	beamDirection := port.Direction.Rotated(-car.Rotation).Unit()
@@ -375,11 +851,7 @@ func (c *RoadSensor) Update(car *Car, background pixel.PictureColor, world *Worl
 	maxBrightness := 0.0
 	for i := 0.0; i < beamLength; i += 0.5 {
 		beamHere := beamStart.Add(beamDirection.Scaled(i))
-		colorHere := background.Color(beamHere)
-		brightnessHere := math.Sqrt(
-			0.299*math.Pow(colorHere.R, 2) +
-				0.587*math.Pow(colorHere.G, 2) +
-				0.114*math.Pow(colorHere.B, 2))
+		brightnessHere := Brightness(background.Color(beamHere))
 
 		// Detection further away from the sensor is less pronounced
 		factor := 1.0
@@ -406,3 +878,389 @@ func (c *RoadSensor) SetInputs(values []float64, connected []bool) {
 func (c *RoadSensor) GetOutputs() []float64 {
 	return []float64{c.value}
 }
+
+// BumpSensor goes high when the side of the car it faces hits an obstacle and stays high
+// while in contact and for the hold time after. The second pin gives the impact speed
+// relative to the top speed.
+type BumpSensor struct {
+	hold float64
+
+	// Number of the car's collision events already looked at.
+	// A sensor added mid-run starts after the events that happened before it existed.
+	seenEvents int
+	started    bool
+	remaining  float64
+	bump       float64
+	impact     float64
+}
+
+func (c *BumpSensor) GetDebugState() string {
+	return strconv.FormatFloat(c.impact, 'g', 3, 64)
+}
+
+func (c *BumpSensor) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+	direction := port.Direction.Rotated(-car.Rotation).Unit()
+	// Contact normals point away from the obstacle, so the sensor has to face against them
+	faces := func(normal pixel.Vec) bool {
+		return direction.Dot(normal) < -0.5
+	}
+
+	if !c.started || c.seenEvents > len(car.CollisionEvents) {
+		c.seenEvents = len(car.CollisionEvents)
+		c.started = true
+	}
+	for _, event := range car.CollisionEvents[c.seenEvents:] {
+		if faces(event.Normal) {
+			c.remaining = c.hold
+			c.impact = math.Min(1, event.ImpactSpeed/car.VehicleDefinition().MaxSpeed)
+		}
+	}
+	c.seenEvents = len(car.CollisionEvents)
+
+	// Staying in contact keeps the output high
+	for _, contact := range car.Contacts {
+		if contact.Surface.Solidity >= 1 && faces(contact.Normal) {
+			c.remaining = math.Max(c.remaining, c.hold)
+		}
+	}
+
+	c.bump = 0
+	if c.remaining > 0 {
+		c.bump = 1
+	}
+	c.remaining -= dt
+	if c.remaining <= 0 {
+		c.impact = 0
+	}
+}
+
+func (c *BumpSensor) SetParameters(values map[string]float64) {
+	c.hold = values["Hold"]
+}
+
+func (c *BumpSensor) SetInputs(values []float64, connected []bool) {
+}
+func (c *BumpSensor) GetOutputs() []float64 {
+	return []float64{c.bump, c.impact}
+}
+
+// VehicleSensor measures the distance to the nearest other car, in any direction.
+// Like the radar it returns 1 when touching and 0 when nothing is in range.
+type VehicleSensor struct {
+	maxDistance float64
+	value       float64
+}
+
+func (c *VehicleSensor) GetDebugState() string {
+	return strconv.FormatFloat(c.value, 'g', 3, 64)
+}
+
+func (c *VehicleSensor) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+	sensor := port.WorldPosition.Rotated(-car.Rotation).Add(car.Position)
+
+	distance := c.maxDistance
+	c.value = 0
+	for _, other := range world.Cars {
+		if other == car {
+			continue
+		}
+		point := other.box().ClosestPoint(sensor)
+		if d := absDistance(point, sensor); d < distance {
+			distance = d
+			c.value = 1 - d/c.maxDistance
+			car.DebugLines = append(car.DebugLines, pixel.L(sensor, point))
+		}
+	}
+}
+
+func (c *VehicleSensor) SetParameters(values map[string]float64) {
+	c.maxDistance = values["Range"]
+}
+
+func (c *VehicleSensor) SetInputs(values []float64, connected []bool) {
+}
+func (c *VehicleSensor) GetOutputs() []float64 {
+	return []float64{c.value}
+}
+
+// Number of ray output pins of the lidar, the nearest hit angle and the hit pin follow them
+const lidarMaxRays = 5
+
+// Lidar sweeps a fan of light beams across its field of view
+type Lidar struct {
+	rays        int
+	fov         float64
+	maxDistance float64
+
+	values [lidarMaxRays]float64
+	angle  float64
+	// 1 if any of the rays hit something, as the angle can't tell
+	hit float64
+}
+
+func (c *Lidar) GetDebugState() string {
+	return strconv.FormatFloat(c.angle, 'g', 3, 64)
+}
+
+func (c *Lidar) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+	beamStart := port.WorldPosition.Rotated(-car.Rotation).Add(car.Position)
+	beamDirection := port.Direction.Rotated(-car.Rotation).Unit()
+
+	c.values = [lidarMaxRays]float64{}
+	c.angle = 0.5
+	c.hit = 0
+	nearest := c.maxDistance
+	for i := 0; i < c.rays; i++ {
+		// Spread the rays from the left to the right edge of the field of view,
+		// a single ray looks straight ahead. 1 is the leftmost, 0 the rightmost ray.
+		side := 0.5
+		if c.rays > 1 {
+			side = 1 - float64(i)/float64(c.rays-1)
+		}
+		direction := beamDirection.Rotated((side - 0.5) * c.fov)
+		beam := pixel.L(beamStart, beamStart.Add(direction.Scaled(c.maxDistance)))
+
+		hit := castLine(world, beam, c.maxDistance, transparentToLight, car)
+		car.DebugLines = append(car.DebugLines, pixel.L(beamStart, hit.Point))
+
+		c.values[i] = (1 - hit.Distance/c.maxDistance) * hit.Surface.ReflectivenessLight
+		if hit.Kind != HitNothing && hit.Distance < nearest {
+			nearest = hit.Distance
+			c.angle = side
+			c.hit = 1
+		}
+	}
+}
+
+func (c *Lidar) SetParameters(values map[string]float64) {
+	c.rays = int(math.Max(1, math.Min(lidarMaxRays, math.Round(values["Rays"]))))
+	c.fov = values["FOV"] * math.Pi / 180
+	c.maxDistance = values["Range"]
+}
+
+func (c *Lidar) SetInputs(values []float64, connected []bool) {
+}
+func (c *Lidar) GetOutputs() []float64 {
+	return append(c.values[:], c.angle, c.hit)
+}
+
+const (
+	cameraColumns = 3
+	cameraRows    = 2
+	cameraCells   = cameraColumns * cameraRows
+	// Samples along each side of a grid cell, averaged into the color of the cell
+	cameraSamples = 3
+)
+
+// Camera looks at a small grid of the ground in front of the sensor
+type Camera struct {
+	depth float64
+	width float64
+
+	// Red, green, blue and brightness of each cell, near cells first, each row from left to right
+	outputs [4 * cameraCells]float64
+}
+
+func (c *Camera) GetDebugState() string {
+	return strconv.FormatFloat(c.outputs[3*cameraCells+cameraColumns/2], 'g', 3, 64)
+}
+
+func (c *Camera) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+	eye := port.WorldPosition.Rotated(-car.Rotation).Add(car.Position)
+	forward := port.Direction.Rotated(-car.Rotation).Unit()
+	left := forward.Rotated(math.Pi / 2)
+
+	cellDepth := c.depth / cameraRows
+	cellWidth := c.width / cameraColumns
+	for row := 0; row < cameraRows; row++ {
+		for column := 0; column < cameraColumns; column++ {
+			var sum pixel.RGBA
+			for y := 0; y < cameraSamples; y++ {
+				for x := 0; x < cameraSamples; x++ {
+					along := (float64(row) + (float64(y)+0.5)/cameraSamples) * cellDepth
+					across := c.width/2 - (float64(column)+(float64(x)+0.5)/cameraSamples)*cellWidth
+					point := eye.Add(forward.Scaled(along)).Add(left.Scaled(across))
+					sum = sum.Add(cameraSample(world, background, car, eye, point))
+				}
+			}
+			color := sum.Scaled(1.0 / (cameraSamples * cameraSamples))
+
+			cell := row*cameraColumns + column
+			c.outputs[cell] = color.R
+			c.outputs[cameraCells+cell] = color.G
+			c.outputs[2*cameraCells+cell] = color.B
+			c.outputs[3*cameraCells+cell] = Brightness(color)
+		}
+	}
+
+	// Outline the area in view
+	nearLeft := eye.Add(left.Scaled(c.width / 2))
+	nearRight := eye.Sub(left.Scaled(c.width / 2))
+	farLeft := nearLeft.Add(forward.Scaled(c.depth))
+	farRight := nearRight.Add(forward.Scaled(c.depth))
+	car.DebugLines = append(car.DebugLines,
+		pixel.L(nearLeft, farLeft),
+		pixel.L(farLeft, farRight),
+		pixel.L(farRight, nearRight),
+		pixel.L(nearRight, nearLeft),
+	)
+}
+
+// cameraSample returns the color seen at the point. Objects in the way block the view
+// and appear as bright as they reflect light.
+func cameraSample(world *World, background pixel.PictureColor, car *Car, eye, point pixel.Vec) pixel.RGBA {
+	hit := castLine(world, pixel.L(eye, point), absDistance(eye, point), transparentToLight, car)
+	if hit.Kind != HitNothing {
+		reflectiveness := hit.Surface.ReflectivenessLight
+		return pixel.RGB(reflectiveness, reflectiveness, reflectiveness)
+	}
+	return background.Color(point)
+}
+
+func (c *Camera) SetParameters(values map[string]float64) {
+	c.depth = values["Range"]
+	c.width = values["Width"]
+}
+
+func (c *Camera) SetInputs(values []float64, connected []bool) {
+}
+func (c *Camera) GetOutputs() []float64 {
+	return c.outputs[:]
+}
+
+// Speedometer gives the speed of the car relative to the top speed of its vehicle
+type Speedometer struct {
+	value float64
+}
+
+func (c *Speedometer) GetDebugState() string {
+	return strconv.FormatFloat(c.value, 'g', 3, 64)
+}
+
+func (c *Speedometer) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+	c.value = car.Speed / car.VehicleDefinition().MaxSpeed
+}
+
+func (c *Speedometer) SetInputs(values []float64, connected []bool) {
+}
+func (c *Speedometer) GetOutputs() []float64 {
+	return []float64{c.value}
+}
+
+// Compass gives sine and cosine of the heading.
+// A heading of 0 points along the X axis of the world, 90 degrees along the Y axis.
+type Compass struct {
+	sin, cos float64
+}
+
+func (c *Compass) GetDebugState() string {
+	return fmt.Sprintf("s: %.2f c: %.2f", c.sin, c.cos)
+}
+
+func (c *Compass) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+	forward := car.Forward()
+	c.sin = forward.Y
+	c.cos = forward.X
+}
+
+func (c *Compass) SetInputs(values []float64, connected []bool) {
+}
+func (c *Compass) GetOutputs() []float64 {
+	return []float64{c.sin, c.cos}
+}
+
+// Gyroscope gives the turn rate of the car in radians per second, split into turning left and right
+type Gyroscope struct {
+	left, right float64
+}
+
+func (c *Gyroscope) GetDebugState() string {
+	return fmt.Sprintf("l: %.2f r: %.2f", c.left, c.right)
+}
+
+func (c *Gyroscope) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+	c.left = math.Max(0, -car.YawRate)
+	c.right = math.Max(0, car.YawRate)
+}
+
+func (c *Gyroscope) SetInputs(values []float64, connected []bool) {
+}
+func (c *Gyroscope) GetOutputs() []float64 {
+	return []float64{c.left, c.right}
+}
+
+// PositionSensor gives the position of the car relative to the size of the world
+type PositionSensor struct {
+	x, y float64
+}
+
+func (c *PositionSensor) GetDebugState() string {
+	return fmt.Sprintf("x: %.2f y: %.2f", c.x, c.y)
+}
+
+func (c *PositionSensor) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+	c.x = car.Position.X / world.Size.X
+	c.y = car.Position.Y / world.Size.Y
+}
+
+func (c *PositionSensor) SetInputs(values []float64, connected []bool) {
+}
+func (c *PositionSensor) GetOutputs() []float64 {
+	return []float64{c.x, c.y}
+}
+
+// GPS guides the car along the waypoints of the world.
+// It gives the angle to the next waypoint, split into left and right, and the distance to it.
+type GPS struct {
+	radius      float64
+	maxDistance float64
+
+	// Index into World.Waypoints of the waypoint to reach next
+	next int
+
+	left, right float64
+	distance    float64
+}
+
+func (c *GPS) GetDebugState() string {
+	return fmt.Sprintf("#%d l: %.2f r: %.2f", c.next, c.left, c.right)
+}
+
+func (c *GPS) Update(dt float64, car *Car, background pixel.PictureColor, world *World, port PortDefinition) {
+	c.left, c.right, c.distance = 0, 0, 0
+	if len(world.Waypoints) == 0 {
+		return
+	}
+
+	// Skip all waypoints already in reach, but don't go round in circles on tiny routes
+	for i := 0; i < len(world.Waypoints); i++ {
+		c.next %= len(world.Waypoints)
+		if absDistance(car.Position, world.Waypoints[c.next]) > c.radius {
+			break
+		}
+		c.next++
+	}
+	c.next %= len(world.Waypoints)
+
+	target := world.Waypoints[c.next]
+	toTarget := car.Position.To(target)
+	// Positive if the waypoint is to the left of the car
+	bearing := normalizeAngle(toTarget.Angle() - car.Forward().Angle())
+
+	c.left = math.Max(0, bearing) / math.Pi
+	c.right = math.Max(0, -bearing) / math.Pi
+	c.distance = math.Min(1, toTarget.Len()/c.maxDistance)
+
+	car.DebugLines = append(car.DebugLines, pixel.L(car.Position, target))
+}
+
+func (c *GPS) SetParameters(values map[string]float64) {
+	c.radius = values["Radius"]
+	c.maxDistance = values["Range"]
+}
+
+func (c *GPS) SetInputs(values []float64, connected []bool) {
+}
+func (c *GPS) GetOutputs() []float64 {
+	return []float64{c.left, c.right, c.distance}
+}
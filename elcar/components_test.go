@@ -0,0 +1,188 @@
+package elcar
+
+import (
+	"math"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+type chipTest struct {
+	name       string
+	parameters map[string]float64
+	inputs     []float64
+	// nil if all pins are connected
+	connected []bool
+	want      float64
+}
+
+// runChip updates a freshly made chip of the given type once and returns its output
+func runChip(typeName string, test chipTest) float64 {
+	chip := ComponentMakerFuncs[typeName]()
+	return updateChip(chip, test.parameters, test.inputs, test.connected)
+}
+
+func updateChip(chip Component, parameters map[string]float64, inputs []float64, connected []bool) float64 {
+	if connected == nil {
+		connected = make([]bool, len(inputs))
+		for i := range connected {
+			connected[i] = true
+		}
+	}
+	if parameterized, ok := chip.(ParameterizedComponent); ok {
+		parameterized.SetParameters(parameters)
+	}
+	chip.SetInputs(inputs, connected)
+	chip.Update(1/ElectronicsTickRate, nil, nil, nil, PortDefinition{})
+	return chip.GetOutputs()[0]
+}
+
+func testChip(t *testing.T, typeName string, tests []chipTest) {
+	for _, test := range tests {
+		if got := runChip(typeName, test); got != test.want {
+			t.Errorf("%s %s: got %g, want %g", typeName, test.name, got, test.want)
+		}
+	}
+}
+
+func TestMin(t *testing.T) {
+	testChip(t, CTypeMin, []chipTest{
+		{name: "all connected", inputs: []float64{0.5, 0.2, 0.8}, want: 0.2},
+		{name: "negative", inputs: []float64{0.5, -1, 0.8}, want: -1},
+		{name: "unconnected pin ignored", inputs: []float64{0.5, 0, 0.8}, connected: []bool{true, false, true}, want: 0.5},
+		{name: "single pin", inputs: []float64{0, 0, 0.3}, connected: []bool{false, false, true}, want: 0.3},
+		{name: "nothing connected", inputs: []float64{0, 0, 0}, connected: []bool{false, false, false}, want: 0},
+	})
+}
+
+func TestMax(t *testing.T) {
+	testChip(t, CTypeMax, []chipTest{
+		{name: "all connected", inputs: []float64{0.5, 0.2, 0.8}, want: 0.8},
+		{name: "negative", inputs: []float64{-0.5, -1, -0.8}, want: -0.5},
+		{name: "unconnected pin ignored", inputs: []float64{-0.5, 0, -0.8}, connected: []bool{true, false, true}, want: -0.5},
+		{name: "nothing connected", inputs: []float64{0, 0, 0}, connected: []bool{false, false, false}, want: 0},
+	})
+}
+
+func TestAbs(t *testing.T) {
+	testChip(t, CTypeAbs, []chipTest{
+		{name: "positive", inputs: []float64{0.5}, want: 0.5},
+		{name: "negative", inputs: []float64{-0.75}, want: 0.75},
+		{name: "zero", inputs: []float64{0}, want: 0},
+	})
+}
+
+func TestInvert(t *testing.T) {
+	testChip(t, CTypeInvert, []chipTest{
+		{name: "zero", inputs: []float64{0}, want: 1},
+		{name: "one", inputs: []float64{1}, want: 0},
+		{name: "negative", inputs: []float64{-1}, want: 2},
+	})
+}
+
+func TestClamp(t *testing.T) {
+	parameters := map[string]float64{"Min": -0.5, "Max": 0.5}
+	testChip(t, CTypeClamp, []chipTest{
+		{name: "inside", parameters: parameters, inputs: []float64{0.25}, want: 0.25},
+		{name: "below", parameters: parameters, inputs: []float64{-2}, want: -0.5},
+		{name: "above", parameters: parameters, inputs: []float64{2}, want: 0.5},
+		{name: "swapped range", parameters: map[string]float64{"Min": 1, "Max": 0}, inputs: []float64{2}, want: 1},
+	})
+}
+
+func TestSchmittTrigger(t *testing.T) {
+	parameters := map[string]float64{"High": 0.6, "Low": 0.4}
+	testChip(t, CTypeSchmittTrigger, []chipTest{
+		{name: "starts off", parameters: parameters, inputs: []float64{0.5}, want: 0},
+		{name: "above high", parameters: parameters, inputs: []float64{0.7}, want: 1},
+		{name: "below low", parameters: parameters, inputs: []float64{0.3}, want: 0},
+		{name: "swapped thresholds", parameters: map[string]float64{"High": 0.4, "Low": 0.6}, inputs: []float64{0.5}, want: 0},
+	})
+
+	// Between the thresholds the output keeps its previous state
+	chip := ComponentMakerFuncs[CTypeSchmittTrigger]()
+	steps := []struct {
+		input, want float64
+	}{
+		{0.5, 0},
+		{0.7, 1},
+		{0.5, 1},
+		{0.41, 1},
+		{0.3, 0},
+		{0.5, 0},
+		{0.59, 0},
+		{0.61, 1},
+	}
+	for i, step := range steps {
+		if got := updateChip(chip, parameters, []float64{step.input}, nil); got != step.want {
+			t.Errorf("schmitt_trigger step %d with input %g: got %g, want %g", i, step.input, got, step.want)
+		}
+	}
+}
+
+func TestDivide(t *testing.T) {
+	parameters := map[string]float64{"Limit": 10}
+	testChip(t, CTypeDivide, []chipTest{
+		{name: "quotient", parameters: parameters, inputs: []float64{1, 4}, want: 0.25},
+		{name: "negative divisor", parameters: parameters, inputs: []float64{1, -2}, want: -0.5},
+		{name: "positive by zero", parameters: parameters, inputs: []float64{1, 0}, want: 10},
+		{name: "zero by zero", parameters: parameters, inputs: []float64{0, 0}, want: 0},
+		{name: "negative by zero", parameters: parameters, inputs: []float64{-1, 0}, want: -10},
+		{name: "limited", parameters: parameters, inputs: []float64{1, 0.01}, want: 10},
+		{name: "limited negative", parameters: parameters, inputs: []float64{-1, 0.01}, want: -10},
+	})
+}
+
+func TestMux(t *testing.T) {
+	testChip(t, CTypeMux, []chipTest{
+		{name: "select low", inputs: []float64{0.2, 0.8, 0}, want: 0.2},
+		{name: "select high", inputs: []float64{0.2, 0.8, 1}, want: 0.8},
+		{name: "select at threshold", inputs: []float64{0.2, 0.8, 0.5}, want: 0.2},
+		{name: "negative input", inputs: []float64{-0.2, 0.8, 0}, want: -0.2},
+	})
+}
+
+func TestBumpSensorIgnoresEarlierCollisions(t *testing.T) {
+	defer func(old Defs) { Definitions = old }(Definitions)
+	Definitions.Vehicles = map[string]VehicleDefinition{
+		DefaultVehicle: {MaxSpeed: 10},
+	}
+
+	frontalHit := CollisionEvent{ImpactSpeed: 5, Normal: pixel.V(-1, 0)}
+	car := &Car{CollisionEvents: []CollisionEvent{frontalHit}}
+	port := PortDefinition{Direction: pixel.V(1, 0)}
+
+	// Added after the car already hit something
+	sensor := ComponentMakerFuncs[CTypeBumpSensor]()
+	sensor.(ParameterizedComponent).SetParameters(map[string]float64{"Hold": 0.5})
+	sensor.Update(1/ElectronicsTickRate, car, nil, nil, port)
+	if bump := sensor.GetOutputs()[0]; bump != 0 {
+		t.Errorf("bump %g for a collision before the sensor existed, want 0", bump)
+	}
+
+	car.CollisionEvents = append(car.CollisionEvents, frontalHit)
+	sensor.Update(1/ElectronicsTickRate, car, nil, nil, port)
+	if outputs := sensor.GetOutputs(); outputs[0] != 1 || outputs[1] != 0.5 {
+		t.Errorf("outputs %v for a new collision, want [1 0.5]", outputs)
+	}
+}
+
+func TestCompass(t *testing.T) {
+	headings := []struct {
+		rotation float64
+		sin, cos float64
+	}{
+		{0, 0, 1},
+		{-math.Pi / 2, 1, 0},
+		{math.Pi, 0, -1},
+		{math.Pi / 2, -1, 0},
+	}
+	compass := ComponentMakerFuncs[CTypeCompass]()
+	for _, heading := range headings {
+		compass.Update(1/ElectronicsTickRate, &Car{Rotation: heading.rotation}, nil, nil, PortDefinition{})
+		outputs := compass.GetOutputs()
+		if math.Abs(outputs[0]-heading.sin) > 1e-9 || math.Abs(outputs[1]-heading.cos) > 1e-9 {
+			t.Errorf("rotation %g: got %v, want [%g %g]", heading.rotation, outputs, heading.sin, heading.cos)
+		}
+	}
+}
@@ -1,10 +1,90 @@
 package elcar
 
-import "github.com/faiface/pixel"
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+	"github.com/faiface/pixel"
+)
 
 type Defs struct {
 	Components map[string]ComponentDefinition
-	Ports      []PortDefinition
+	Vehicles   map[string]VehicleDefinition
+	Chassis    map[string]ChassisDefinition
+}
+
+// Vehicle used for new designs and for saves without a vehicle
+const DefaultVehicle = "standard"
+
+type VehicleDefinition struct {
+	Name string
+
+	Acceleration float64
+	MaxSpeed     float64
+	// Turn rate in radians per second at full steering, used by the arcade dynamics
+	SteerRate float64
+	// Size of the collision box, along and across the car
+	Length float64
+	Width  float64
+
+	// Used by the bicycle dynamics
+	Wheelbase     float64
+	MaxSteerAngle float64
+	// Higher values reduce the turn rate at speed
+	Understeer float64
+	// Maximum lateral acceleration the tyres can provide before sliding
+	Grip float64
+}
+
+// validate rejects values the dynamics can't handle, which would leave the car stuck or produce NaN
+func (v VehicleDefinition) validate() error {
+	positive := []struct {
+		name  string
+		value float64
+	}{
+		{"Acceleration", v.Acceleration},
+		{"MaxSpeed", v.MaxSpeed},
+		{"Length", v.Length},
+		{"Width", v.Width},
+		{"Wheelbase", v.Wheelbase},
+	}
+	for _, field := range positive {
+		if field.value <= 0 {
+			return fmt.Errorf("%s must be positive", field.name)
+		}
+	}
+	notNegative := []struct {
+		name  string
+		value float64
+	}{
+		{"SteerRate", v.SteerRate},
+		{"MaxSteerAngle", v.MaxSteerAngle},
+		{"Understeer", v.Understeer},
+		{"Grip", v.Grip},
+	}
+	for _, field := range notNegative {
+		if field.value < 0 {
+			return fmt.Errorf("%s must not be negative", field.name)
+		}
+	}
+	return nil
+}
+
+// Chassis used for new designs and for saves without a chassis
+const DefaultChassis = "standard"
+
+// ChassisDefinition describes the hood of a car and where its components are placed
+type ChassisDefinition struct {
+	Name        string
+	Description string
+	// Sprite of the opened hood, in the sprite folder
+	HoodSprite string
+	// Vehicle that new designs on this chassis start with
+	Vehicle string
+	Ports   []PortDefinition
 }
 
 type PortKind string
@@ -29,6 +109,7 @@ type ComponentDefinition struct {
 	PortKind   PortKind
 	InputPins  []PinDefinition
 	OutputPins []PinDefinition
+	Parameters []ParameterDefinition
 
 	Name        string
 	Description string
@@ -38,6 +119,51 @@ type PinDefinition struct {
 	Position pixel.Vec
 }
 
+// ParameterDefinition describes a value that can be set per placed component
+type ParameterDefinition struct {
+	Name    string
+	Default float64
+	Min     float64
+	Max     float64
+	// Increment used when editing, defaults to 1/100 of the range
+	Step float64
+}
+
+func (p ParameterDefinition) Clamp(value float64) float64 {
+	if value < p.Min {
+		return p.Min
+	}
+	if value > p.Max {
+		return p.Max
+	}
+	return value
+}
+
+func (p ParameterDefinition) Increment() float64 {
+	if p.Step > 0 {
+		return p.Step
+	}
+	return (p.Max - p.Min) / 100
+}
+
+// DefaultParameters returns the parameter values of a newly placed component
+func (c ComponentDefinition) DefaultParameters() map[string]float64 {
+	values := make(map[string]float64, len(c.Parameters))
+	for _, param := range c.Parameters {
+		values[param.Name] = param.Default
+	}
+	return values
+}
+
+func (c ComponentDefinition) GetParameter(name string) (ParameterDefinition, bool) {
+	for _, param := range c.Parameters {
+		if param.Name == name {
+			return param, true
+		}
+	}
+	return ParameterDefinition{}, false
+}
+
 func GetOutPinPosition(typeName string, port int) pixel.Vec {
 	def, ok := Definitions.Components[typeName]
 	if !ok {
@@ -64,11 +190,11 @@ func GetInPinPosition(typeName string, port int) pixel.Vec {
 	return def.InputPins[port].Position
 }
 
-func IsComponentAllowedInSlot(id int, typeName string) bool {
-	if id < 0 || id >= len(Definitions.Ports) {
+func (c ChassisDefinition) IsComponentAllowedInSlot(id int, typeName string) bool {
+	if id < 0 || id >= len(c.Ports) {
 		return false
 	}
-	portDef := Definitions.Ports[id]
+	portDef := c.Ports[id]
 	componentDef, ok := Definitions.Components[typeName]
 	if !ok {
 		return false
@@ -77,7 +203,7 @@ func IsComponentAllowedInSlot(id int, typeName string) bool {
 }
 
 type SpriteDefs struct {
-	Props      map[string]SpriteDefinition
+	Props      map[string]PropDefinition
 	Components map[string]SpriteDefinition
 }
 
@@ -85,3 +211,84 @@ type SpriteDefinition struct {
 	Start pixel.Vec
 	Size  pixel.Vec
 }
+
+type PropDefinition struct {
+	Start pixel.Vec
+	Size  pixel.Vec
+
+	Solidity            float64
+	ReflectivenessLight float64
+	ReflectivenessRadar float64
+}
+
+func (p PropDefinition) Surface() Surface {
+	return Surface{
+		Solidity:            p.Solidity,
+		ReflectivenessLight: p.ReflectivenessLight,
+		ReflectivenessRadar: p.ReflectivenessRadar,
+	}
+}
+
+// VehicleNames returns the names of all vehicles in a stable order
+func VehicleNames() []string {
+	names := make([]string, 0, len(Definitions.Vehicles))
+	for name := range Definitions.Vehicles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ChassisNames returns the names of all chassis in a stable order
+func ChassisNames() []string {
+	names := make([]string, 0, len(Definitions.Chassis))
+	for name := range Definitions.Chassis {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadDefinitions reads the component and sprite definitions from the given resource folder
+func LoadDefinitions(resourceFolder string) error {
+	_, err := toml.DecodeFile(filepath.Join(resourceFolder, "definitions.toml"), &Definitions)
+	if err != nil {
+		return err
+	}
+	if _, ok := Definitions.Vehicles[DefaultVehicle]; !ok {
+		return errors.New("definitions are missing the default vehicle " + DefaultVehicle)
+	}
+	for name, vehicle := range Definitions.Vehicles {
+		err = vehicle.validate()
+		if err != nil {
+			return fmt.Errorf("vehicle %s: %v", name, err)
+		}
+	}
+	if _, ok := Definitions.Chassis[DefaultChassis]; !ok {
+		return errors.New("definitions are missing the default chassis " + DefaultChassis)
+	}
+	for name, chassis := range Definitions.Chassis {
+		if _, ok := Definitions.Vehicles[chassis.Vehicle]; !ok {
+			return errors.New("chassis " + name + " uses unknown vehicle " + chassis.Vehicle)
+		}
+	}
+
+	spritesFile := filepath.Join(resourceFolder, "sprites.toml")
+	_, err = toml.DecodeFile(spritesFile, &SpriteDefinitions)
+	if err != nil {
+		return err
+	}
+
+	var raw struct {
+		Props map[string]map[string]interface{}
+	}
+	_, err = toml.DecodeFile(spritesFile, &raw)
+	if err != nil {
+		return err
+	}
+	for name, def := range SpriteDefinitions.Props {
+		setSurfaceDefaults(raw.Props[name], &def.Solidity, &def.ReflectivenessLight, &def.ReflectivenessRadar)
+		SpriteDefinitions.Props[name] = def
+	}
+	return nil
+}
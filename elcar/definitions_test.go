@@ -0,0 +1,46 @@
+package elcar
+
+import (
+	"testing"
+)
+
+func TestVehicleDefinitionValidate(t *testing.T) {
+	valid := VehicleDefinition{
+		Acceleration:  3,
+		MaxSpeed:      15,
+		SteerRate:     0.8,
+		Length:        14,
+		Width:         12,
+		Wheelbase:     9,
+		MaxSteerAngle: 0.5,
+		Understeer:    0.02,
+		Grip:          8,
+	}
+	if err := valid.validate(); err != nil {
+		t.Errorf("valid vehicle rejected: %v", err)
+	}
+
+	broken := map[string]func(v *VehicleDefinition){
+		"zero acceleration":   func(v *VehicleDefinition) { v.Acceleration = 0 },
+		"negative max speed":  func(v *VehicleDefinition) { v.MaxSpeed = -1 },
+		"zero wheelbase":      func(v *VehicleDefinition) { v.Wheelbase = 0 },
+		"zero width":          func(v *VehicleDefinition) { v.Width = 0 },
+		"negative understeer": func(v *VehicleDefinition) { v.Understeer = -0.1 },
+		"negative grip":       func(v *VehicleDefinition) { v.Grip = -1 },
+	}
+	for name, breakVehicle := range broken {
+		vehicle := valid
+		breakVehicle(&vehicle)
+		if err := vehicle.validate(); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestLoadDefinitions(t *testing.T) {
+	defer func(old Defs) { Definitions = old }(Definitions)
+	defer func(old SpriteDefs) { SpriteDefinitions = old }(SpriteDefinitions)
+	if err := LoadDefinitions("../resources"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,106 @@
+package elcar
+
+import (
+	"math"
+	"sort"
+
+	"github.com/faiface/pixel"
+)
+
+const (
+	DynamicsArcade  = "arcade"
+	DynamicsBicycle = "bicycle"
+)
+
+// Model used for new designs, saves without a model use DynamicsArcade
+const DefaultDynamics = DynamicsBicycle
+
+// DynamicsModel moves a car according to its steering, acceleration and braking
+type DynamicsModel interface {
+	// Step updates the speed of the car and returns the pose it would
+	// reach after dt seconds if nothing is in the way
+	Step(c *Car, vehicle VehicleDefinition, dt float64) (position pixel.Vec, rotation float64)
+}
+
+var DynamicsModels = map[string]DynamicsModel{
+	DynamicsArcade:  ArcadeDynamics{},
+	DynamicsBicycle: BicycleDynamics{},
+}
+
+// DynamicsModelNames returns the names of all dynamics models in a stable order
+func DynamicsModelNames() []string {
+	names := make([]string, 0, len(DynamicsModels))
+	for name := range DynamicsModels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func getDynamicsModel(name string) DynamicsModel {
+	model, ok := DynamicsModels[name]
+	if !ok {
+		return DynamicsModels[DynamicsArcade]
+	}
+	return model
+}
+
+// updateSpeed applies acceleration and braking to the speed along the car
+func updateSpeed(c *Car, vehicle VehicleDefinition, dt float64) {
+	c.Speed += c.Acceleration * vehicle.Acceleration * dt
+	if c.Speed > vehicle.MaxSpeed {
+		c.Speed = vehicle.MaxSpeed
+	}
+	c.Speed -= c.Braking * vehicle.Acceleration * dt
+	if c.Speed < 0 {
+		c.Speed = 0
+	}
+}
+
+// ArcadeDynamics turns the car at a fixed rate and moves it straight ahead,
+// even when standing still.
+type ArcadeDynamics struct{}
+
+func (ArcadeDynamics) Step(c *Car, vehicle VehicleDefinition, dt float64) (pixel.Vec, float64) {
+	rotation := c.Rotation + c.Steering*vehicle.SteerRate*dt
+
+	updateSpeed(c, vehicle, dt)
+	c.LateralSpeed = 0
+
+	forward := pixel.Unit(-rotation)
+	return c.Position.Add(forward.Scaled(c.Speed * dt)), rotation
+}
+
+// BicycleDynamics treats the car as a single front and rear wheel.
+// The turn rate depends on speed and steering angle, turns get wider at speed
+// and the car slides sideways when the tyres run out of grip.
+type BicycleDynamics struct{}
+
+func (BicycleDynamics) Step(c *Car, vehicle VehicleDefinition, dt float64) (pixel.Vec, float64) {
+	steering := math.Max(-1, math.Min(1, c.Steering))
+	steerAngle := steering * vehicle.MaxSteerAngle
+
+	yawRate := c.Speed * math.Tan(steerAngle) / (vehicle.Wheelbase + vehicle.Understeer*c.Speed*c.Speed)
+	rotation := c.Rotation + yawRate*dt
+
+	// The velocity keeps its direction while the car turns underneath it,
+	// the tyres then pull it back in line as far as their grip allows.
+	velocity := pixel.Unit(-c.Rotation).Scaled(c.Speed).Add(pixel.Unit(-c.Rotation + math.Pi/2).Scaled(c.LateralSpeed))
+	forward := pixel.Unit(-rotation)
+	left := pixel.Unit(-rotation + math.Pi/2)
+
+	c.Speed = math.Max(0, velocity.Dot(forward))
+	lateral := velocity.Dot(left)
+	maxCorrection := vehicle.Grip * dt
+	if math.Abs(lateral) <= maxCorrection {
+		lateral = 0
+	} else {
+		lateral -= math.Copysign(maxCorrection, lateral)
+	}
+	c.LateralSpeed = lateral
+
+	updateSpeed(c, vehicle, dt)
+
+	velocity = forward.Scaled(c.Speed).Add(left.Scaled(c.LateralSpeed))
+	return c.Position.Add(velocity.Scaled(dt)), rotation
+}
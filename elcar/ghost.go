@@ -0,0 +1,128 @@
+package elcar
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+	"github.com/faiface/pixel"
+)
+
+// GhostFrame is the pose of a car after one physics step
+type GhostFrame struct {
+	Position pixel.Vec
+	Rotation float64
+	Speed    float64
+}
+
+// Ghost is the recording of a lap, to replay it next to the car and compare times
+type Ghost struct {
+	// Frames recorded per second
+	TickRate float64
+	Frames   []GhostFrame
+
+	// Distance driven up to each frame, built on first use
+	distances []float64
+}
+
+// Record appends the pose of the car as the next frame
+func (g *Ghost) Record(c *Car) {
+	g.Frames = append(g.Frames, GhostFrame{
+		Position: c.Position,
+		Rotation: c.Rotation,
+		Speed:    c.Speed,
+	})
+	if g.distances != nil {
+		g.distances = append(g.distances, g.distances[len(g.distances)-1]+g.step(len(g.Frames)-1))
+	}
+}
+
+// Duration returns the recorded time in seconds
+func (g *Ghost) Duration() float64 {
+	if g.TickRate <= 0 {
+		return 0
+	}
+	return float64(len(g.Frames)) / g.TickRate
+}
+
+// Distance returns the length of the recorded path
+func (g *Ghost) Distance() float64 {
+	distances := g.cumulativeDistances()
+	if len(distances) == 0 {
+		return 0
+	}
+	return distances[len(distances)-1]
+}
+
+// Frame returns the pose at the given time since the start of the recording.
+// Returns false if the time is outside of the recording.
+func (g *Ghost) Frame(time float64) (GhostFrame, bool) {
+	// Each frame is recorded at the end of its physics step
+	index := int(math.Max(0, math.Round(time*g.TickRate)-1))
+	if time < 0 || index >= len(g.Frames) {
+		return GhostFrame{}, false
+	}
+	return g.Frames[index], true
+}
+
+// TimeAt returns the time at which the recorded car had driven the given distance.
+// Returns false if the recorded car never got that far.
+func (g *Ghost) TimeAt(distance float64) (float64, bool) {
+	distances := g.cumulativeDistances()
+	if len(distances) == 0 || distance > distances[len(distances)-1] {
+		return 0, false
+	}
+	index := sort.SearchFloat64s(distances, distance)
+	time := float64(index+1) / g.TickRate
+
+	// Interpolate within the step, so the time does not jump from frame to frame
+	if index > 0 && distances[index] > distances[index-1] {
+		fraction := (distances[index] - distance) / (distances[index] - distances[index-1])
+		time -= fraction / g.TickRate
+	}
+	return time, true
+}
+
+func (g *Ghost) cumulativeDistances() []float64 {
+	if g.distances == nil && len(g.Frames) > 0 {
+		g.distances = make([]float64, len(g.Frames))
+		for i := 1; i < len(g.Frames); i++ {
+			g.distances[i] = g.distances[i-1] + g.step(i)
+		}
+	}
+	return g.distances
+}
+
+// step returns the distance driven to reach the frame with the given index
+func (g *Ghost) step(index int) float64 {
+	if index == 0 {
+		return 0
+	}
+	return g.Frames[index-1].Position.To(g.Frames[index].Position).Len()
+}
+
+func (g *Ghost) Save(filename string) error {
+	dir, _ := filepath.Split(filename)
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return toml.NewEncoder(file).Encode(g)
+}
+
+func LoadGhost(filename string) (*Ghost, error) {
+	var ghost Ghost
+	_, err := toml.DecodeFile(filename, &ghost)
+	if err != nil {
+		return nil, err
+	}
+	return &ghost, nil
+}
@@ -0,0 +1,121 @@
+package elcar
+
+import (
+	"math"
+
+	"github.com/faiface/pixel"
+)
+
+// Edge length of the grid cells of the spatial index, in world units
+const indexCellSize = 16
+
+// indexedObject is a static wall or prop stored in the spatial index
+type indexedObject struct {
+	Bounds  pixel.Rect
+	Kind    HitKind
+	Index   int
+	Surface Surface
+}
+
+// spatialIndex is a uniform grid over the world. Each cell lists the objects
+// overlapping it, so geometry queries only need to look at nearby objects.
+type spatialIndex struct {
+	origin        pixel.Vec
+	cellSize      float64
+	columns, rows int
+
+	objects []indexedObject
+	cells   [][]int
+
+	// Objects spanning several cells are only reported once per query
+	visited []int
+	queryID int
+}
+
+// newSpatialIndex indexes the walls and props of the world in cells of the given edge length.
+// With an infinite cell size all objects share a single cell, so every query looks at all of them.
+func newSpatialIndex(world *World, cellSize float64) *spatialIndex {
+	// Objects outside of the world end up in the border cells, as cell coordinates are clamped
+	area := world.Bounds().Norm()
+	idx := &spatialIndex{
+		origin:   area.Min,
+		cellSize: cellSize,
+		columns:  int(math.Max(1, math.Ceil(area.W()/cellSize))),
+		rows:     int(math.Max(1, math.Ceil(area.H()/cellSize))),
+	}
+
+	for i, o := range world.Walls {
+		idx.objects = append(idx.objects, indexedObject{
+			Bounds:  o.Bounds(),
+			Kind:    HitWall,
+			Index:   i,
+			Surface: o.Surface(),
+		})
+	}
+	for i, o := range world.Props {
+		def, ok := SpriteDefinitions.Props[o.Name]
+		if !ok {
+			continue
+		}
+		idx.objects = append(idx.objects, indexedObject{
+			Bounds:  o.Bounds(def),
+			Kind:    HitProp,
+			Index:   i,
+			Surface: def.Surface(),
+		})
+	}
+
+	idx.cells = make([][]int, idx.columns*idx.rows)
+	idx.visited = make([]int, len(idx.objects))
+	for i, o := range idx.objects {
+		minX, minY, maxX, maxY := idx.cellRange(o.Bounds)
+		for y := minY; y <= maxY; y++ {
+			for x := minX; x <= maxX; x++ {
+				cell := y*idx.columns + x
+				idx.cells[cell] = append(idx.cells[cell], i)
+			}
+		}
+	}
+
+	return idx
+}
+
+// cellRange returns the cells covered by the area, clamped to the grid
+func (idx *spatialIndex) cellRange(area pixel.Rect) (minX, minY, maxX, maxY int) {
+	clamp := func(value float64, max int) int {
+		cell := int(math.Floor(value / idx.cellSize))
+		if cell < 0 {
+			return 0
+		}
+		if cell > max {
+			return max
+		}
+		return cell
+	}
+
+	area = area.Norm()
+	minX = clamp(area.Min.X-idx.origin.X, idx.columns-1)
+	minY = clamp(area.Min.Y-idx.origin.Y, idx.rows-1)
+	maxX = clamp(area.Max.X-idx.origin.X, idx.columns-1)
+	maxY = clamp(area.Max.Y-idx.origin.Y, idx.rows-1)
+	return
+}
+
+// Query calls fn for every object whose cells overlap the area.
+// Objects are reported at most once, but may not actually intersect the area.
+func (idx *spatialIndex) Query(area pixel.Rect, fn func(o indexedObject)) {
+	idx.queryID++
+
+	minX, minY, maxX, maxY := idx.cellRange(area)
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			for _, i := range idx.cells[y*idx.columns+x] {
+				if idx.visited[i] == idx.queryID {
+					continue
+				}
+				idx.visited[i] = idx.queryID
+				fn(idx.objects[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package elcar
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+// testWorld generates a world with the given number of small walls at random positions.
+// Some of them lie partly or fully outside of the world, where the index clamps them into the border cells.
+func testWorld(walls int) *World {
+	rng := rand.New(rand.NewSource(1))
+	world := &World{
+		Size: pixel.V(2000, 2000),
+	}
+	for i := 0; i < walls; i++ {
+		wall := Wall{
+			Pos:                 pixel.V(rng.Float64()*2100-50, rng.Float64()*2100-50),
+			Size:                pixel.V(rng.Float64()*20-10, rng.Float64()*20-10),
+			Solidity:            1,
+			ReflectivenessLight: 1,
+			ReflectivenessRadar: 1,
+		}
+		world.Walls = append(world.Walls, wall)
+	}
+	return world
+}
+
+// linearScan makes the world look at all walls and props in every query, like before the spatial index existed
+func linearScan(world *World) *World {
+	scan := *world
+	scan.index = newSpatialIndex(&scan, math.Inf(1))
+	return &scan
+}
+
+type testQuery struct {
+	line     pixel.Line
+	circle   pixel.Circle
+	position pixel.Vec
+	rotation float64
+}
+
+// testQueries generates sensor rays, sensor circles and car poses all over the world and just outside of it
+func testQueries(count int) []testQuery {
+	rng := rand.New(rand.NewSource(2))
+	queries := make([]testQuery, count)
+	for i := range queries {
+		start := pixel.V(rng.Float64()*2100-50, rng.Float64()*2100-50)
+		direction := pixel.Unit(rng.Float64() * 2 * math.Pi)
+		queries[i] = testQuery{
+			line:     pixel.L(start, start.Add(direction.Scaled(rng.Float64()*100))),
+			circle:   pixel.C(start, rng.Float64()*20),
+			position: start,
+			rotation: rng.Float64() * 2 * math.Pi,
+		}
+	}
+	return queries
+}
+
+var testVehicle = VehicleDefinition{
+	Length: 12,
+	Width:  6,
+}
+
+func sortedContacts(contacts []Contact) []Contact {
+	sort.Slice(contacts, func(i, j int) bool {
+		if contacts[i].Kind != contacts[j].Kind {
+			return contacts[i].Kind < contacts[j].Kind
+		}
+		return contacts[i].Index < contacts[j].Index
+	})
+	return contacts
+}
+
+func TestSpatialIndexMatchesLinearScan(t *testing.T) {
+	grid := testWorld(5000)
+	scan := linearScan(grid)
+	car := &Car{}
+
+	for i, q := range testQueries(500) {
+		if got, want := castLine(grid, q.line, 100, nil, nil), castLine(scan, q.line, 100, nil, nil); got != want {
+			t.Errorf("query %d: castLine hit %+v, linear scan hit %+v", i, got, want)
+		}
+
+		direction := q.line.B.Sub(q.line.A).Unit()
+		if got, want := castCircle(grid, q.circle, direction, 20, nil, nil), castCircle(scan, q.circle, direction, 20, nil, nil); got != want {
+			t.Errorf("query %d: castCircle hit %+v, linear scan hit %+v", i, got, want)
+		}
+
+		got := sortedContacts(car.contactsAt(q.position, q.rotation, testVehicle, grid))
+		want := sortedContacts(car.contactsAt(q.position, q.rotation, testVehicle, scan))
+		if len(got) != len(want) {
+			t.Errorf("query %d: %d contacts, linear scan found %d", i, len(got), len(want))
+			continue
+		}
+		for j := range got {
+			if got[j] != want[j] {
+				t.Errorf("query %d: contact %+v, linear scan found %+v", i, got[j], want[j])
+			}
+		}
+	}
+}
+
+// benchmarkIndex runs the query against the spatial index and against a linear scan of all walls
+func benchmarkIndex(b *testing.B, query func(world *World, q testQuery)) {
+	grid := testWorld(5000)
+	worlds := map[string]*World{
+		"grid":   grid,
+		"linear": linearScan(grid),
+	}
+	queries := testQueries(1000)
+
+	for _, name := range []string{"grid", "linear"} {
+		world := worlds[name]
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				query(world, queries[i%len(queries)])
+			}
+		})
+	}
+}
+
+func BenchmarkCastLine(b *testing.B) {
+	benchmarkIndex(b, func(world *World, q testQuery) {
+		castLine(world, q.line, 100, nil, nil)
+	})
+}
+
+func BenchmarkCastCircle(b *testing.B) {
+	benchmarkIndex(b, func(world *World, q testQuery) {
+		castCircle(world, q.circle, pixel.V(1, 0), 20, nil, nil)
+	})
+}
+
+func BenchmarkContacts(b *testing.B) {
+	car := &Car{}
+	benchmarkIndex(b, func(world *World, q testQuery) {
+		car.contactsAt(q.position, q.rotation, testVehicle, world)
+	})
+}
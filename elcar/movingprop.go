@@ -0,0 +1,118 @@
+package elcar
+
+import (
+	"fmt"
+
+	"github.com/faiface/pixel"
+)
+
+const (
+	// MoveLoop returns to the first waypoint after the last one
+	MoveLoop = "loop"
+	// MovePingPong walks the path back and forth
+	MovePingPong = "pingpong"
+)
+
+// MovingProp is a prop following a path of waypoints, e.g. a pedestrian or a barrier that opens
+type MovingProp struct {
+	Name string
+	// Waypoints of the lower left corner of the prop, starting at the first one
+	Path []pixel.Vec
+	// World units per second
+	Speed float64
+	// MoveLoop or MovePingPong, defaults to MoveLoop
+	Mode string
+	// Seconds to wait at each waypoint
+	Wait float64
+
+	Pos pixel.Vec `toml:"-"`
+
+	target    int
+	direction int
+	waiting   float64
+}
+
+// validate checks the settings decoded from a world file and fills in the defaults
+func (p *MovingProp) validate() error {
+	if p.Mode == "" {
+		p.Mode = MoveLoop
+	}
+	if p.Mode != MoveLoop && p.Mode != MovePingPong {
+		return fmt.Errorf("moving prop %q: unknown mode %q", p.Name, p.Mode)
+	}
+	if len(p.Path) == 0 {
+		return fmt.Errorf("moving prop %q: no path", p.Name)
+	}
+	if p.Speed < 0 {
+		return fmt.Errorf("moving prop %q: negative speed", p.Name)
+	}
+	return nil
+}
+
+// Reset puts the prop back at the start of its path
+func (p *MovingProp) Reset() {
+	if len(p.Path) > 0 {
+		p.Pos = p.Path[0]
+	}
+	p.target = 0
+	p.direction = 1
+	p.waiting = p.Wait
+	p.advance()
+}
+
+// Step moves the prop along its path for dt seconds
+func (p *MovingProp) Step(dt float64) {
+	if len(p.Path) < 2 || p.Speed <= 0 {
+		return
+	}
+
+	// A waypoint is reached at most once per pass through the path,
+	// so paths of zero length can't keep this busy.
+	for i := 0; i <= len(p.Path) && dt > 0; i++ {
+		if p.waiting > 0 {
+			if p.waiting >= dt {
+				p.waiting -= dt
+				return
+			}
+			dt -= p.waiting
+			p.waiting = 0
+		}
+
+		target := p.Path[p.target]
+		distance := target.Sub(p.Pos).Len()
+		travel := p.Speed * dt
+		if travel < distance {
+			p.Pos = p.Pos.Add(target.Sub(p.Pos).Scaled(travel / distance))
+			return
+		}
+
+		p.Pos = target
+		dt -= distance / p.Speed
+		p.waiting = p.Wait
+		p.advance()
+	}
+}
+
+// advance picks the next waypoint to head for
+func (p *MovingProp) advance() {
+	if len(p.Path) < 2 {
+		return
+	}
+	next := p.target + p.direction
+	if next < 0 || next >= len(p.Path) {
+		if p.Mode == MovePingPong {
+			p.direction = -p.direction
+			next = p.target + p.direction
+		} else {
+			next = 0
+		}
+	}
+	p.target = next
+}
+
+func (p MovingProp) Bounds(def PropDefinition) pixel.Rect {
+	return pixel.Rect{
+		Min: p.Pos,
+		Max: p.Pos.Add(def.Size),
+	}
+}
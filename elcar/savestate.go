@@ -9,24 +9,45 @@ import (
 )
 
 type SavedCar struct {
+	// Saves from before dynamics models were selectable use DynamicsArcade,
+	// saves without a vehicle or chassis use DefaultVehicle and DefaultChassis
+	Dynamics   string `toml:",omitempty"`
+	Vehicle    string `toml:",omitempty"`
+	Chassis    string `toml:",omitempty"`
 	Components []SavedComponent
 }
 
 type SavedComponent struct {
-	ID               int
-	TypeName         string
-	ConnectedOutputs []ComponentDestination
+	ID         int
+	TypeName   string
+	Outputs    []SavedOutput
+	Parameters map[string]float64 `toml:",omitempty"`
+
+	// Saves from before fan-out support had exactly one destination per output pin
+	ConnectedOutputs []ComponentDestination `toml:",omitempty"`
+}
+
+type SavedOutput struct {
+	Destinations []ComponentDestination
 }
 
 func (c *Car) Save(filename string) error {
 	saved := SavedCar{
+		Dynamics:   c.Dynamics,
+		Vehicle:    c.Vehicle,
+		Chassis:    c.Chassis,
 		Components: make([]SavedComponent, len(c.Components)),
 	}
 	for i, comp := range c.Components {
+		outputs := make([]SavedOutput, len(comp.ConnectedOutputs))
+		for pin, destinations := range comp.ConnectedOutputs {
+			outputs[pin].Destinations = destinations
+		}
 		saved.Components[i] = SavedComponent{
-			ID:               comp.ID,
-			TypeName:         comp.TypeName,
-			ConnectedOutputs: comp.ConnectedOutputs,
+			ID:         comp.ID,
+			TypeName:   comp.TypeName,
+			Outputs:    outputs,
+			Parameters: comp.Parameters,
 		}
 	}
 
@@ -53,6 +74,22 @@ func (c *Car) Load(filename string) error {
 		return err
 	}
 
+	c.Dynamics = saved.Dynamics
+	if c.Dynamics == "" {
+		c.Dynamics = DynamicsArcade
+	}
+	c.Vehicle = saved.Vehicle
+	if c.Vehicle == "" {
+		c.Vehicle = DefaultVehicle
+	}
+	c.Chassis = saved.Chassis
+	if c.Chassis == "" {
+		c.Chassis = DefaultChassis
+	}
+	if _, ok := Definitions.Chassis[c.Chassis]; !ok {
+		return errors.New("saved car has unknown chassis " + c.Chassis)
+	}
+
 	c.Components = make([]UsedComponent, len(saved.Components))
 	for i, comp := range saved.Components {
 		maker, ok := ComponentMakerFuncs[comp.TypeName]
@@ -63,9 +100,45 @@ func (c *Car) Load(filename string) error {
 		c.Components[i] = UsedComponent{
 			ID:               comp.ID,
 			TypeName:         comp.TypeName,
-			ConnectedOutputs: comp.ConnectedOutputs,
+			ConnectedOutputs: comp.loadOutputs(),
+			Parameters:       comp.loadParameters(),
 			State:            maker(),
 		}
 	}
 	return nil
 }
+
+func (comp SavedComponent) loadOutputs() [][]ComponentDestination {
+	pinCount := len(Definitions.Components[comp.TypeName].OutputPins)
+	outputs := make([][]ComponentDestination, pinCount)
+
+	if len(comp.Outputs) == 0 {
+		// Old format, unconnected pins were stored with ID -1
+		for pin, dest := range comp.ConnectedOutputs {
+			if pin < pinCount && dest.ID >= 0 {
+				outputs[pin] = []ComponentDestination{dest}
+			}
+		}
+		return outputs
+	}
+
+	for pin, out := range comp.Outputs {
+		if pin < pinCount {
+			outputs[pin] = out.Destinations
+		}
+	}
+	return outputs
+}
+
+// loadParameters fills in defaults for parameters missing in the save and
+// drops the ones no longer defined for the component.
+func (comp SavedComponent) loadParameters() map[string]float64 {
+	def := Definitions.Components[comp.TypeName]
+	values := def.DefaultParameters()
+	for _, param := range def.Parameters {
+		if value, ok := comp.Parameters[param.Name]; ok {
+			values[param.Name] = param.Clamp(value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,73 @@
+package sim
+
+// Report summarizes a run for scoring and comparing car designs
+type Report struct {
+	Seconds      float64 `json:"seconds"`
+	Distance     float64 `json:"distance"`
+	TimeOnRoad   float64 `json:"time_on_road"`
+	Collisions   int     `json:"collisions"`
+	AverageSpeed float64 `json:"average_speed"`
+	FinalPose    Pose    `json:"final_pose"`
+
+	// Completed laps, their times and the shortest one in seconds (0 without a lap)
+	Laps     int       `json:"laps"`
+	LapTimes []float64 `json:"lap_times"`
+	BestLap  float64   `json:"best_lap"`
+	// Index of the checkpoint passed last in the current lap, -1 if none yet
+	LastCheckpoint int `json:"last_checkpoint"`
+
+	CollisionEvents []Collision `json:"collision_events"`
+}
+
+type Pose struct {
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	Rotation float64 `json:"rotation"`
+	Speed    float64 `json:"speed"`
+}
+
+// Collision is a single impact of the car
+type Collision struct {
+	Time        float64 `json:"time"`
+	X           float64 `json:"x"`
+	Y           float64 `json:"y"`
+	ImpactSpeed float64 `json:"impact_speed"`
+	// "wall", "prop", "moving_prop", "car" or "bounds", with the index into the matching list of the world
+	Hit   string `json:"hit"`
+	Index int    `json:"index"`
+}
+
+// Report summarizes the run since the last reset
+func (s *Simulation) Report() Report {
+	report := Report{
+		Seconds:    s.Elapsed,
+		Distance:   s.Distance,
+		TimeOnRoad: s.TimeOnRoad,
+		Collisions: s.Car.Collisions,
+		FinalPose: Pose{
+			X:        s.Car.Position.X,
+			Y:        s.Car.Position.Y,
+			Rotation: s.Car.Rotation,
+			Speed:    s.Car.Speed,
+		},
+		Laps:           s.Car.Progress.Laps,
+		LapTimes:       append([]float64{}, s.Car.Progress.LapTimes...),
+		BestLap:        s.Car.Progress.BestLap(),
+		LastCheckpoint: s.Car.Progress.LastCheckpoint,
+	}
+	report.CollisionEvents = make([]Collision, len(s.Car.CollisionEvents))
+	for i, event := range s.Car.CollisionEvents {
+		report.CollisionEvents[i] = Collision{
+			Time:        event.Time,
+			X:           event.Position.X,
+			Y:           event.Position.Y,
+			ImpactSpeed: event.ImpactSpeed,
+			Hit:         event.Kind.String(),
+			Index:       event.Index,
+		}
+	}
+	if s.Elapsed > 0 {
+		report.AverageSpeed = s.Distance / s.Elapsed
+	}
+	return report
+}
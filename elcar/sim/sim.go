@@ -0,0 +1,161 @@
+// Package sim drives a car through a world without opening a window, so circuits
+// can be evaluated from scripts or on machines without a GPU.
+package sim
+
+import (
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+
+	// Enable loading of PNG files
+	_ "image/png"
+
+	"github.com/faiface/pixel"
+	"github.com/founderio/autopilot_testbed/elcar"
+)
+
+// Ground darker than this counts as road. The asphalt is far darker than the grass,
+// so the exact value is not critical.
+const RoadBrightness = 0.25
+
+type Simulation struct {
+	World      *elcar.World
+	Background pixel.PictureColor
+	// The evaluated car, other cars in World.Cars are traffic
+	Car *elcar.Car
+
+	// Simulated seconds and steps since the last reset
+	Elapsed float64
+	Ticks   int
+
+	// Distance driven and seconds spent on the road since the last reset
+	Distance   float64
+	TimeOnRoad float64
+}
+
+// State is a snapshot of the simulated car
+type State struct {
+	Ticks   int
+	Elapsed float64
+
+	Position pixel.Vec
+	Rotation float64
+	Speed    float64
+}
+
+// Load reads the definitions from resourceFolder, the world and its background sprite,
+// and places the car from the given save file at the first spawn point.
+func Load(resourceFolder, worldFile, carFile string) (*Simulation, error) {
+	err := elcar.LoadDefinitions(resourceFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	world, err := elcar.LoadWorld(worldFile)
+	if err != nil {
+		return nil, err
+	}
+
+	background, err := LoadPicture(filepath.Join(resourceFolder, "sprites", world.BackgroundSprite))
+	if err != nil {
+		return nil, err
+	}
+
+	car := &elcar.Car{}
+	err = car.Load(carFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(world, background, car), nil
+}
+
+// New creates a simulation and places the car at the first spawn point
+func New(world *elcar.World, background pixel.PictureColor, car *elcar.Car) *Simulation {
+	world.Cars = []*elcar.Car{car}
+	s := &Simulation{
+		World:      world,
+		Background: background,
+		Car:        car,
+	}
+	s.Reset()
+	return s
+}
+
+// AddTraffic loads another car from a save file and restarts the simulation with
+// the new car at the next spawn point
+func (s *Simulation) AddTraffic(carFile string) error {
+	car := &elcar.Car{}
+	err := car.Load(carFile)
+	if err != nil {
+		return err
+	}
+	s.World.Cars = append(s.World.Cars, car)
+	s.Reset()
+	return nil
+}
+
+func LoadPicture(filename string) (*pixel.PictureData, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+	return pixel.PictureDataFromImage(img), nil
+}
+
+// Reset places the cars back at the spawn points and restarts the clock
+func (s *Simulation) Reset() {
+	s.World.Reset()
+	s.Elapsed = 0
+	s.Ticks = 0
+	s.Distance = 0
+	s.TimeOnRoad = 0
+}
+
+// Step advances the simulation by dt seconds.
+// Steps longer than the maximum update time of the world are split up, so no time is dropped.
+func (s *Simulation) Step(dt float64) {
+	for dt > 0 {
+		chunk := math.Min(dt, elcar.MaxUpdateTime)
+		s.advance(chunk)
+		dt -= chunk
+	}
+	s.Ticks++
+}
+
+func (s *Simulation) advance(dt float64) {
+	previousPosition := s.Car.Position
+
+	s.World.Update(dt, s.Background)
+	s.Elapsed += dt
+
+	s.Distance += previousPosition.To(s.Car.Position).Len()
+	if elcar.Brightness(s.Background.Color(s.Car.Position)) < RoadBrightness {
+		s.TimeOnRoad += dt
+	}
+}
+
+// Run advances the simulation by the given number of fixed steps and returns the final state
+func (s *Simulation) Run(ticks int, dt float64) State {
+	for i := 0; i < ticks; i++ {
+		s.Step(dt)
+	}
+	return s.State()
+}
+
+func (s *Simulation) State() State {
+	return State{
+		Ticks:   s.Ticks,
+		Elapsed: s.Elapsed,
+
+		Position: s.Car.Position,
+		Rotation: s.Car.Rotation,
+		Speed:    s.Car.Speed,
+	}
+}
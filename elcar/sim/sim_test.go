@@ -0,0 +1,22 @@
+package sim
+
+import (
+	"testing"
+)
+
+// The example car predates negative signals and has to keep completing laps of the racetrack
+func TestExampleCar(t *testing.T) {
+	s, err := Load("../../resources", "../../resources/worlds/racetrack.toml", "../../build/example_car.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Run(120*60, 1.0/60)
+
+	report := s.Report()
+	if report.Laps < 1 {
+		t.Errorf("completed %d laps, want at least 1", report.Laps)
+	}
+	if report.TimeOnRoad < 0.8*report.Seconds {
+		t.Errorf("on the road for %.1fs of %.1fs", report.TimeOnRoad, report.Seconds)
+	}
+}
@@ -1,15 +1,160 @@
 package elcar
 
 import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
 	"github.com/faiface/pixel"
 )
 
+// Folder below the resource and the data folder holding the world files
+const WorldFolder = "worlds"
+
+// Track loaded when none is selected
+const DefaultTrack = "racetrack"
+
 type World struct {
 	Scale            float64
 	BackgroundSprite string
 	Size             pixel.Vec
 	Walls            []Wall
 	Props            []Prop
+	MovingProps      []MovingProp
+
+	// Poses of the cars after a reset, in the order of World.Cars
+	SpawnPoints []SpawnPoint
+	// Lines to pass in order, the last one is the finish line
+	Checkpoints []Checkpoint
+	// Route followed by the gps, starting over after the last one
+	Waypoints []pixel.Vec
+
+	// Cars driving in the world, the first one is the player's
+	Cars []*Car `toml:"-"`
+
+	index *spatialIndex
+
+	// Simulation time not yet consumed by the fixed-rate clocks
+	electronicsAccumulator float64
+	physicsAccumulator     float64
+}
+
+func LoadWorld(filename string) (*World, error) {
+	var world World
+	_, err := toml.DecodeFile(filename, &world)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw struct {
+		Walls []map[string]interface{}
+	}
+	_, err = toml.DecodeFile(filename, &raw)
+	if err != nil {
+		return nil, err
+	}
+	for i := range world.Walls {
+		wall := &world.Walls[i]
+		setSurfaceDefaults(raw.Walls[i], &wall.Solidity, &wall.ReflectivenessLight, &wall.ReflectivenessRadar)
+	}
+	err = world.validate()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filepath.Base(filename), err)
+	}
+	for i := range world.MovingProps {
+		world.MovingProps[i].Reset()
+	}
+
+	return &world, nil
+}
+
+// validate checks the settings decoded from a world file and fills in the defaults
+func (w *World) validate() error {
+	if w.Size.X <= 0 || w.Size.Y <= 0 {
+		return errors.New("world size must be positive")
+	}
+	if w.BackgroundSprite == "" {
+		return errors.New("world has no background sprite")
+	}
+	for i, spawn := range w.SpawnPoints {
+		if !w.Bounds().Contains(spawn.Pos) {
+			return fmt.Errorf("spawn point %d is outside of the world", i)
+		}
+	}
+	for i, checkpoint := range w.Checkpoints {
+		if checkpoint.A == checkpoint.B {
+			return fmt.Errorf("checkpoint %d has no length", i)
+		}
+	}
+	for i := range w.MovingProps {
+		err := w.MovingProps[i].validate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindTracks returns the world files in the given folders by track name, which is the file name without extension.
+// Tracks in later folders replace those of the same name in earlier ones, missing folders are skipped.
+func FindTracks(folders ...string) (map[string]string, error) {
+	tracks := make(map[string]string)
+	for _, folder := range folders {
+		files, err := ioutil.ReadDir(folder)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if file.IsDir() || filepath.Ext(file.Name()) != ".toml" {
+				continue
+			}
+			tracks[strings.TrimSuffix(file.Name(), ".toml")] = filepath.Join(folder, file.Name())
+		}
+	}
+	return tracks, nil
+}
+
+// TrackNames returns the names of the tracks in a stable order
+func TrackNames(tracks map[string]string) []string {
+	names := make([]string, 0, len(tracks))
+	for name := range tracks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// setSurfaceDefaults sets the surface properties not present in a decoded table to 1,
+// so objects are solid and visible to all sensors unless configured otherwise.
+func setSurfaceDefaults(raw map[string]interface{}, solidity, reflectivenessLight, reflectivenessRadar *float64) {
+	defaults := map[string]*float64{
+		"Solidity":            solidity,
+		"ReflectivenessLight": reflectivenessLight,
+		"ReflectivenessRadar": reflectivenessRadar,
+	}
+	for key, value := range defaults {
+		if _, ok := raw[key]; !ok {
+			*value = 1
+		}
+	}
+}
+
+// spatialIndex returns the index of walls and props, building it on first use.
+// Walls and props don't change once the world is loaded, moving props are kept out of the index.
+func (w *World) spatialIndex() *spatialIndex {
+	if w.index == nil {
+		w.index = newSpatialIndex(w, indexCellSize)
+	}
+	return w.index
 }
 
 func (w World) Bounds() pixel.Rect {
@@ -29,9 +174,18 @@ type Wall struct {
 }
 
 func (c Wall) Bounds() pixel.Rect {
+	// Walls may be defined with a negative size
 	return pixel.Rect{
 		Min: c.Pos,
 		Max: c.Pos.Add(c.Size),
+	}.Norm()
+}
+
+func (c Wall) Surface() Surface {
+	return Surface{
+		Solidity:            c.Solidity,
+		ReflectivenessLight: c.ReflectivenessLight,
+		ReflectivenessRadar: c.ReflectivenessRadar,
 	}
 }
 
@@ -40,9 +194,107 @@ type Prop struct {
 	Name string
 }
 
-func (c Prop) Bounds(def SpriteDefinition) pixel.Rect {
+func (c Prop) Bounds(def PropDefinition) pixel.Rect {
 	return pixel.Rect{
 		Min: c.Pos,
 		Max: c.Pos.Add(def.Size),
 	}
 }
+
+// Surface describes how strongly an object interacts with the car and its sensors,
+// from 0 (not at all) to 1 (fully).
+// A car inside an object with a Solidity below 1 loses that fraction of its speed per second,
+// e.g. 0.5 halves the speed every second.
+type Surface struct {
+	Solidity            float64
+	ReflectivenessLight float64
+	ReflectivenessRadar float64
+}
+
+// The world bounds are solid and visible to all sensors
+var boundsSurface = Surface{
+	Solidity:            1,
+	ReflectivenessLight: 1,
+	ReflectivenessRadar: 1,
+}
+
+// Cars are solid and visible to all sensors, just like the bounds
+var carSurface = boundsSurface
+
+// Distance between the cars lined up ahead of the last spawn point, if there are more cars than spawn points
+const carSpacing = 25
+
+// Update advances the moving props and all cars in the world by dt seconds.
+// All of them are stepped tick by tick together, so the cars see each other at the same point in time.
+func (w *World) Update(dt float64, background pixel.PictureColor) {
+	// Don't try to catch up on huge frame times (window dragged, debugger paused, ...)
+	dt = math.Min(dt, MaxUpdateTime)
+
+	electronicsStep := 1 / ElectronicsTickRate
+	physicsStep := 1 / PhysicsTickRate
+
+	w.electronicsAccumulator += dt
+	w.physicsAccumulator += dt
+
+	// Run both clocks in the order their ticks became due, so the electronics
+	// always see the world state of the matching point in time.
+	for w.electronicsAccumulator >= electronicsStep || w.physicsAccumulator >= physicsStep {
+		if w.electronicsAccumulator-electronicsStep >= w.physicsAccumulator-physicsStep {
+			w.electronicsAccumulator -= electronicsStep
+			for _, car := range w.Cars {
+				car.updateElectronics(electronicsStep, background, w)
+			}
+		} else {
+			w.physicsAccumulator -= physicsStep
+			for i := range w.MovingProps {
+				w.MovingProps[i].Step(physicsStep)
+			}
+			for _, car := range w.Cars {
+				car.updatePhysics(physicsStep, w)
+			}
+		}
+	}
+}
+
+// Reset puts the moving props back at the start of their paths and the cars at the spawn points
+func (w *World) Reset() {
+	w.electronicsAccumulator = 0
+	w.physicsAccumulator = 0
+	for i := range w.MovingProps {
+		w.MovingProps[i].Reset()
+	}
+
+	for i, car := range w.Cars {
+		spawn := w.SpawnPoint(i)
+		car.Reset(spawn.Pos, spawn.Rotation)
+	}
+}
+
+// SpawnPoint returns the spawn point of the car with the given index in World.Cars.
+// Cars without a spawn point of their own are lined up ahead of the last one,
+// Worlds without any spawn points start the cars in the middle.
+func (w *World) SpawnPoint(index int) SpawnPoint {
+	spawnPoints := w.SpawnPoints
+	if len(spawnPoints) == 0 {
+		spawnPoints = []SpawnPoint{{Pos: w.Size.Scaled(0.5)}}
+	}
+	last := len(spawnPoints) - 1
+	if index <= last {
+		return spawnPoints[index]
+	}
+	spawn := spawnPoints[last]
+	forward := pixel.Unit(-spawn.Rotation)
+	spawn.Pos = spawn.Pos.Add(forward.Scaled(float64(index-last) * carSpacing))
+	return spawn
+}
+
+// eachMovingProp calls fn for every moving prop with a known sprite definition
+func (w *World) eachMovingProp(fn func(index int, bounds pixel.Rect, surface Surface)) {
+	for i, o := range w.MovingProps {
+		def, ok := SpriteDefinitions.Props[o.Name]
+		if !ok {
+			continue
+		}
+		fn(i, o.Bounds(def), def.Surface())
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/pixelgl"
+	"github.com/founderio/autopilot_testbed/elcar"
+	"github.com/founderio/autopilot_testbed/paths"
+)
+
+var (
+	// Name of the world file without extension, ghosts are kept per track
+	trackName string
+	// Save slot the car was loaded from or saved to last, -1 for a new car
+	currentSlot = -1
+
+	// Fastest lap of the car on this track, nil if there is none yet
+	ghost *elcar.Ghost
+	// Lap of the car already compared against the ghost
+	ghostCheckedLap *elcar.Ghost
+)
+
+func getGhostFileName(slot int) string {
+	return filepath.Join(paths.GetDataPath(), "ghosts", fmt.Sprintf("%s_save_%d.toml", trackName, slot))
+}
+
+// loadGhost switches to the ghost of the current save slot
+func loadGhost() {
+	ghost = nil
+	ghostCheckedLap = nil
+	if currentSlot < 0 {
+		return
+	}
+
+	loaded, err := elcar.LoadGhost(getGhostFileName(currentSlot))
+	if err == nil {
+		ghost = loaded
+	} else if !os.IsNotExist(err) {
+		saveLoadError = err.Error()
+	}
+}
+
+// updateGhost replaces the ghost once the car completes a faster lap
+func updateGhost() {
+	lap := car.LastLap
+	if lap == nil || lap == ghostCheckedLap {
+		return
+	}
+	ghostCheckedLap = lap
+
+	if ghost != nil && ghost.Duration() <= lap.Duration() {
+		return
+	}
+	ghost = lap
+	if currentSlot >= 0 {
+		err := ghost.Save(getGhostFileName(currentSlot))
+		if err != nil {
+			saveLoadError = err.Error()
+		}
+	}
+}
+
+// ghostDelta returns how many seconds the car is behind the ghost at the same distance into the lap
+func ghostDelta() (float64, bool) {
+	if ghost == nil {
+		return 0, false
+	}
+	ghostTime, ok := ghost.TimeAt(car.CurrentLap.Distance())
+	if !ok {
+		return 0, false
+	}
+	return car.CurrentLap.Duration() - ghostTime, true
+}
+
+func drawGhost(win *pixelgl.Window, carSprite *pixel.Sprite) {
+	if ghost == nil {
+		return
+	}
+	frame, ok := ghost.Frame(car.CurrentLap.Duration())
+	if !ok {
+		return
+	}
+
+	mat := pixel.IM.Rotated(pixel.ZV, -frame.Rotation)
+	mat = mat.Moved(frame.Position)
+	mat = mat.Scaled(pixel.ZV, world.Scale)
+	carSprite.DrawColorMask(win, mat, pixel.Alpha(0.35))
+}
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,7 +16,6 @@ import (
 	"image/color"
 	_ "image/png"
 
-	"github.com/BurntSushi/toml"
 	"github.com/faiface/pixel"
 	"github.com/faiface/pixel/imdraw"
 	"github.com/faiface/pixel/pixelgl"
@@ -29,6 +29,9 @@ import (
 const spriteFolder = "resources/sprites"
 
 func main() {
+	if runCommand(os.Args[1:]) {
+		return
+	}
 	pixelgl.Run(run)
 }
 
@@ -49,7 +52,7 @@ func loadPicture(filename string) (*pixel.PictureData, error) {
 var (
 	fontAtlas *text.Atlas
 
-	carHoodSprite     *pixel.Sprite
+	hoodSprites       map[string]*pixel.Sprite
 	componentBGSprite *pixel.Sprite
 
 	componentEmpty   *pixel.Sprite
@@ -71,6 +74,12 @@ var (
 var (
 	car   *elcar.Car
 	world *elcar.World
+
+	worldPic    *pixel.PictureData
+	worldSprite *pixel.Sprite
+
+	// World files by track name
+	tracks map[string]string
 )
 
 var (
@@ -80,7 +89,9 @@ var (
 	connectingFromID    int
 	connectingFromPort  int
 
-	selectingComponent string
+	selectingComponent  string
+	editingComponentID  = -1
+	componentListScroll float64
 
 	dragRectStartPoint pixel.Vec
 
@@ -107,15 +118,24 @@ const (
 	MenuMain
 	MenuSave
 	MenuLoad
+	MenuNew
+	MenuTraffic
+	MenuTrack
 	MenuCredits
 )
 
 func run() {
 
-	_, err := toml.DecodeFile(filepath.Join("resources", "world.toml"), &world)
+	var err error
+	err = findTracks()
+	if err != nil {
+		panic(err)
+	}
+	world, err = elcar.LoadWorld(tracks[elcar.DefaultTrack])
 	if err != nil {
 		panic(err)
 	}
+	trackName = elcar.DefaultTrack
 	// Safeguard against wacky maths
 	if world.Scale <= 0.1 {
 		world.Scale = 3
@@ -130,12 +150,7 @@ func run() {
 		panic(err)
 	}
 
-	_, err = toml.DecodeFile(filepath.Join("resources", "definitions.toml"), &elcar.Definitions)
-	if err != nil {
-		panic(err)
-	}
-
-	_, err = toml.DecodeFile(filepath.Join("resources", "sprites.toml"), &elcar.SpriteDefinitions)
+	err = elcar.LoadDefinitions("resources")
 	if err != nil {
 		panic(err)
 	}
@@ -156,11 +171,14 @@ func run() {
 	}
 	carSprite := pixel.NewSprite(carPic, carPic.Bounds())
 
-	carHoodPic, err := loadPicture("car_circuits.png")
-	if err != nil {
-		panic(err)
+	hoodSprites = make(map[string]*pixel.Sprite)
+	for name, def := range elcar.Definitions.Chassis {
+		hoodPic, err := loadPicture(def.HoodSprite)
+		if err != nil {
+			panic(err)
+		}
+		hoodSprites[name] = pixel.NewSprite(hoodPic, hoodPic.Bounds())
 	}
-	carHoodSprite = pixel.NewSprite(carHoodPic, carHoodPic.Bounds())
 
 	componentBGPic, err := loadPicture("component_bg.png")
 	if err != nil {
@@ -168,11 +186,11 @@ func run() {
 	}
 	componentBGSprite = pixel.NewSprite(componentBGPic, componentBGPic.Bounds())
 
-	worldPic, err := loadPicture(world.BackgroundSprite)
+	worldPic, err = loadPicture(world.BackgroundSprite)
 	if err != nil {
 		panic(err)
 	}
-	worldSprite := pixel.NewSprite(worldPic, worldPic.Bounds())
+	worldSprite = pixel.NewSprite(worldPic, worldPic.Bounds())
 
 	// Prop Sprites
 	propSprites = make(map[string]*pixel.Sprite)
@@ -213,17 +231,7 @@ func run() {
 	spriteChipPort = pixel.NewSprite(pcbSpriteSheet, pixel.R(48, 0, 48+14, 18))
 
 	// Initialize a default car
-	car = &elcar.Car{
-		Position: pixel.V(210, 204),
-		Rotation: math.Pi,
-		Speed:    0,
-	}
-
-	for idx, port := range elcar.Definitions.Ports {
-		if port.Prefill != "" {
-			car.AddComponent(idx, port.Prefill)
-		}
-	}
+	newCar(elcar.DefaultChassis)
 
 	imd := imdraw.New(nil)
 
@@ -249,6 +257,12 @@ func run() {
 			switch menu {
 			case MenuLoad:
 				fallthrough
+			case MenuNew:
+				fallthrough
+			case MenuTraffic:
+				fallthrough
+			case MenuTrack:
+				fallthrough
 			case MenuSave:
 				fallthrough
 			case MenuCredits:
@@ -264,7 +278,8 @@ func run() {
 			}
 		}
 
-		car.Update(dt, worldPic, world)
+		world.Update(dt, worldPic)
+		updateGhost()
 
 		win.Clear(colornames.Gainsboro)
 
@@ -281,28 +296,53 @@ func run() {
 			}
 		}
 
-		// Props
-		for _, o := range world.Props {
-			sprite, ok := propSprites[o.Name]
-			if !ok {
-				sprite = spriteChipPort
+		// Checkpoints, the finish line stands out
+		if overlays == OverlaysAll {
+			for i, o := range world.Checkpoints {
+				imd.Clear()
+				imd.Color = colornames.Yellow
+				if i == len(world.Checkpoints)-1 {
+					imd.Color = colornames.White
+				}
+				imd.EndShape = imdraw.SharpEndShape
+				imd.Push(o.A.Scaled(world.Scale), o.B.Scaled(world.Scale))
+				imd.Line(2)
+				imd.Draw(win)
 			}
+		}
 
-			sprite.Draw(win, pixel.IM.Moved(sprite.Frame().Size().Scaled(0.5)).Moved(o.Pos).Scaled(pixel.ZV, world.Scale))
-
-			if overlays == OverlaysAll {
+		// Route of the gps
+		if overlays == OverlaysAll {
+			for _, o := range world.Waypoints {
 				imd.Clear()
-				imd.Color = colornames.Lightblue
-				imd.Push(o.Pos.Scaled(world.Scale), o.Pos.Add(sprite.Frame().Size()).Scaled(world.Scale))
-				imd.Rectangle(2)
+				imd.Color = colornames.Orange
+				imd.Push(o.Scaled(world.Scale))
+				imd.Circle(3*world.Scale, 2)
 				imd.Draw(win)
 			}
 		}
 
-		mat := pixel.IM.Rotated(pixel.ZV, -car.Rotation)
-		mat = mat.Moved(car.Position)
-		mat = mat.Scaled(pixel.ZV, world.Scale)
-		carSprite.Draw(win, mat)
+		// Props
+		for _, o := range world.Props {
+			drawProp(win, imd, o.Name, o.Pos)
+		}
+		for _, o := range world.MovingProps {
+			drawProp(win, imd, o.Name, o.Pos)
+		}
+
+		drawGhost(win, carSprite)
+
+		for i, c := range world.Cars {
+			mat := pixel.IM.Rotated(pixel.ZV, -c.Rotation)
+			mat = mat.Moved(c.Position)
+			mat = mat.Scaled(pixel.ZV, world.Scale)
+			if i == 0 {
+				carSprite.Draw(win, mat)
+			} else {
+				// Tint traffic to tell it apart from the player's car
+				carSprite.DrawColorMask(win, mat, colornames.Lightskyblue)
+			}
+		}
 
 		if overlays >= OverlaysSensors {
 			for _, debug := range car.DebugPoints {
@@ -341,10 +381,12 @@ func run() {
 			if drawMenuButton(win, fontAtlas, "Menu [Esc]", pixel.R(0, win.Bounds().H()-50, 350, win.Bounds().H())) {
 				menu = MenuMain
 			}
+			drawHUD(win)
 
 		case MenuHood:
 			drawHood(win, dt)
 			drawComponentSelector(win, dt)
+			drawParameterEditor(win, dt)
 			if drawMenuButton(win, fontAtlas, "Close Hood [Tab]", pixel.R(0, 256*hoodScale, 350, 256*hoodScale+50)) {
 				menu = MenuHood
 			}
@@ -358,6 +400,15 @@ func run() {
 		case MenuSave:
 			drawSaveMenu(win, dt)
 
+		case MenuNew:
+			drawNewCarMenu(win, dt)
+
+		case MenuTraffic:
+			drawTrafficMenu(win, dt)
+
+		case MenuTrack:
+			drawTrackMenu(win, dt)
+
 		case MenuCredits:
 			drawCredits(win, dt)
 		}
@@ -366,16 +417,82 @@ func run() {
 	}
 }
 
+// newCar replaces the car with an empty design on the given chassis
+func newCar(chassis string) {
+	dynamics := elcar.DefaultDynamics
+	if car != nil {
+		dynamics = car.Dynamics
+	}
+
+	car = &elcar.Car{
+		Dynamics: dynamics,
+		Vehicle:  elcar.Definitions.Chassis[chassis].Vehicle,
+		Chassis:  chassis,
+	}
+	car.AddPrefilledComponents()
+
+	if len(world.Cars) == 0 {
+		world.Cars = []*elcar.Car{car}
+	} else {
+		world.Cars[0] = car
+	}
+	resetCarPosition()
+
+	currentSlot = -1
+	loadGhost()
+
+	editingComponentID = -1
+	connectingFromState = NotConnecting
+}
+
+// hoodSprite returns the sprite of the opened hood of the car's chassis
+func hoodSprite() *pixel.Sprite {
+	sprite, ok := hoodSprites[car.Chassis]
+	if !ok {
+		return hoodSprites[elcar.DefaultChassis]
+	}
+	return sprite
+}
+
 func resetCarPosition() {
-	car.Position = pixel.V(210, 204)
-	car.Rotation = math.Pi
-	car.Speed = 0
+	world.Reset()
+}
+
+// drawHUD shows the time, speed and the progress of the player's car through the checkpoints
+func drawHUD(win *pixelgl.Window) {
+	info := fmt.Sprintf("Time %.2fs  Speed %.1f", car.Time, car.Speed)
+	if len(world.Checkpoints) > 0 {
+		progress := car.Progress
+		info += fmt.Sprintf("  Lap %d  Checkpoint %d/%d", progress.Laps+1, progress.LastCheckpoint+1, len(world.Checkpoints))
+		info += fmt.Sprintf("\nLap time %.2fs", car.CurrentLap.Duration())
+		if delta, ok := ghostDelta(); ok {
+			info += fmt.Sprintf(" (%+.2fs)", delta)
+		}
+		if progress.Laps > 0 {
+			info += fmt.Sprintf("  Last %.2fs  Best %.2fs", progress.LapTimes[progress.Laps-1], progress.BestLap())
+		}
+		if ghost != nil {
+			info += fmt.Sprintf("  Ghost %.2fs", ghost.Duration())
+		}
+	}
+	drawText(win, fontAtlas, info, pixel.V(400, win.Bounds().H()-35))
+}
 
-	car.Steering = 0
-	car.Acceleration = 0
-	car.Braking = 0
+func drawProp(win *pixelgl.Window, imd *imdraw.IMDraw, name string, pos pixel.Vec) {
+	sprite, ok := propSprites[name]
+	if !ok {
+		sprite = spriteChipPort
+	}
+
+	sprite.Draw(win, pixel.IM.Moved(sprite.Frame().Size().Scaled(0.5)).Moved(pos).Scaled(pixel.ZV, world.Scale))
 
-	car.ResetComponentState()
+	if overlays == OverlaysAll {
+		imd.Clear()
+		imd.Color = colornames.Lightblue
+		imd.Push(pos.Scaled(world.Scale), pos.Add(sprite.Frame().Size()).Scaled(world.Scale))
+		imd.Rectangle(2)
+		imd.Draw(win)
+	}
 }
 
 func toggleOverlays() {
@@ -400,22 +517,55 @@ func drawMainMenu(win *pixelgl.Window, dt float64) {
 		menu = MenuClosed
 	}
 
-	if drawMenuButton(win, fontAtlas, "Save Car", rectAround(win.Bounds().Center().Add(pixel.V(0, 150)), buttonSize)) {
+	if drawMenuButton(win, fontAtlas, "New Car", rectAround(win.Bounds().Center().Add(pixel.V(-235, 150)), buttonSize)) {
+		menu = MenuNew
+	}
+	if drawMenuButton(win, fontAtlas, "Track: "+trackName, rectAround(win.Bounds().Center().Add(pixel.V(235, 150)), buttonSize)) {
+		menu = MenuTrack
+		saveLoadError = ""
+		err := findTracks()
+		if err != nil {
+			saveLoadError = err.Error()
+		}
+	}
+	if drawMenuButton(win, fontAtlas, "Save Car", rectAround(win.Bounds().Center().Add(pixel.V(-235, 50)), buttonSize)) {
 		menu = MenuSave
 		loadSaveEntries()
 	}
-	if drawMenuButton(win, fontAtlas, "Load Car", rectAround(win.Bounds().Center().Add(pixel.V(0, 50)), buttonSize)) {
+	if drawMenuButton(win, fontAtlas, "Load Car", rectAround(win.Bounds().Center().Add(pixel.V(235, 50)), buttonSize)) {
 		menu = MenuLoad
 		loadSaveEntries()
 	}
-	if drawMenuButton(win, fontAtlas, "Credits", rectAround(win.Bounds().Center().Add(pixel.V(0, -50)), buttonSize)) {
+	if drawMenuButton(win, fontAtlas, fmt.Sprintf("Traffic: %d", len(world.Cars)-1), rectAround(win.Bounds().Center().Add(pixel.V(-235, -50)), buttonSize)) {
+		menu = MenuTraffic
+		loadSaveEntries()
+	}
+	if drawMenuButton(win, fontAtlas, "Credits", rectAround(win.Bounds().Center().Add(pixel.V(235, -50)), buttonSize)) {
 		menu = MenuCredits
 	}
+	if drawMenuButton(win, fontAtlas, "Dynamics: "+car.Dynamics, rectAround(win.Bounds().Center().Add(pixel.V(-235, -150)), buttonSize)) {
+		car.Dynamics = nextName(elcar.DynamicsModelNames(), car.Dynamics)
+		car.RestartLap()
+	}
+	if drawMenuButton(win, fontAtlas, "Vehicle: "+car.VehicleDefinition().Name, rectAround(win.Bounds().Center().Add(pixel.V(235, -150)), buttonSize)) {
+		car.Vehicle = nextName(elcar.VehicleNames(), car.Vehicle)
+		car.RestartLap()
+	}
 	if drawMenuButton(win, fontAtlas, "Exit", rectAround(win.Bounds().Center().Add(pixel.V(0, -250)), buttonSize)) {
 		win.SetClosed(true)
 	}
 }
 
+// nextName returns the name following current in the list, wrapping around at the end
+func nextName(names []string, current string) string {
+	for i, name := range names {
+		if name == current {
+			return names[(i+1)%len(names)]
+		}
+	}
+	return names[0]
+}
+
 func drawLoadMenu(win *pixelgl.Window, dt float64) {
 	buttonSize := pixel.V(450, 50)
 
@@ -482,6 +632,89 @@ func drawSaveMenu(win *pixelgl.Window, dt float64) {
 	}
 }
 
+func drawNewCarMenu(win *pixelgl.Window, dt float64) {
+	buttonSize := pixel.V(450, 50)
+
+	drawMenuButton(win, fontAtlas, "New Car", rectAround(win.Bounds().Center().Add(pixel.V(0, 150)), buttonSize))
+	if drawMenuButton(win, fontAtlas, "<", rectAround(win.Bounds().Center().Add(pixel.V(-275, 150)), pixel.V(50, 50))) {
+		menu = MenuMain
+	}
+
+	for i, name := range elcar.ChassisNames() {
+		chassis := elcar.Definitions.Chassis[name]
+		center := win.Bounds().Center().Add(pixel.V(0, float64(50-i*100)))
+
+		if drawMenuButton(win, fontAtlas, chassis.Name, rectAround(center, buttonSize)) {
+			newCar(name)
+			menu = MenuHood
+		}
+		drawText(win, fontAtlas, chassis.Description, center.Add(pixel.V(buttonSize.X/2+20, -10)))
+	}
+}
+
+// drawTrafficMenu lets saved cars join the world as traffic, placed at the further spawn points
+func drawTrafficMenu(win *pixelgl.Window, dt float64) {
+	buttonSize := pixel.V(450, 50)
+
+	drawMenuButton(win, fontAtlas, "Add Traffic", rectAround(win.Bounds().Center().Add(pixel.V(0, 150)), buttonSize))
+	if drawMenuButton(win, fontAtlas, "<", rectAround(win.Bounds().Center().Add(pixel.V(-275, 150)), pixel.V(50, 50))) {
+		menu = MenuMain
+	}
+	if drawMenuButton(win, fontAtlas, "Clear Traffic", rectAround(win.Bounds().Center().Add(pixel.V(0, 250)), buttonSize)) {
+		world.Cars = world.Cars[:1]
+		resetCarPosition()
+	}
+
+	if saveLoadError != "" {
+		drawError(win, fontAtlas, saveLoadError, win.Bounds().Center().Add(pixel.V(0, 220)))
+	}
+
+	for i, entry := range saveEntries {
+		if !entry.Used {
+			continue
+		}
+		buttonRect := rectAround(win.Bounds().Center().Add(pixel.V(0, float64(50-i*100))), buttonSize)
+		if drawMenuButton(win, fontAtlas, entry.Created.Format("2006-01-02 15:04:05"), buttonRect) {
+			err := addTraffic(i)
+			if err == nil {
+				saveLoadError = ""
+			} else {
+				saveLoadError = err.Error()
+			}
+		}
+	}
+}
+
+func drawTrackMenu(win *pixelgl.Window, dt float64) {
+	buttonSize := pixel.V(450, 50)
+
+	drawMenuButton(win, fontAtlas, "Select Track", rectAround(win.Bounds().Center().Add(pixel.V(0, 150)), buttonSize))
+	if drawMenuButton(win, fontAtlas, "<", rectAround(win.Bounds().Center().Add(pixel.V(-275, 150)), pixel.V(50, 50))) {
+		menu = MenuMain
+	}
+
+	if saveLoadError != "" {
+		drawError(win, fontAtlas, saveLoadError, win.Bounds().Center().Add(pixel.V(0, 220)))
+	}
+
+	for i, name := range elcar.TrackNames(tracks) {
+		buttonText := name
+		if name == trackName {
+			buttonText = "> " + name + " <"
+		}
+		buttonRect := rectAround(win.Bounds().Center().Add(pixel.V(0, float64(50-i*100))), buttonSize)
+		if drawMenuButton(win, fontAtlas, buttonText, buttonRect) {
+			err := switchTrack(win, name)
+			if err == nil {
+				saveLoadError = ""
+				menu = MenuClosed
+			} else {
+				saveLoadError = err.Error()
+			}
+		}
+	}
+}
+
 func drawCredits(win *pixelgl.Window, dt float64) {
 	buttonSize := pixel.V(450, 50)
 
@@ -494,14 +727,85 @@ func drawCredits(win *pixelgl.Window, dt float64) {
 	drawCreditsText(win, fontAtlas, "Built using "+runtime.Version()+" and the Pixel engine", win.Bounds().Center())
 }
 
+// findTracks looks for world files in the resources and the save file directory
+func findTracks() error {
+	var err error
+	tracks, err = elcar.FindTracks(filepath.Join("resources", elcar.WorldFolder), filepath.Join(paths.GetDataPath(), elcar.WorldFolder))
+	return err
+}
+
+// switchTrack loads the world of the track and moves all cars over to it
+func switchTrack(win *pixelgl.Window, name string) error {
+	filename, ok := tracks[name]
+	if !ok {
+		return fmt.Errorf("unknown track %q", name)
+	}
+	newWorld, err := elcar.LoadWorld(filename)
+	if err != nil {
+		return err
+	}
+	newWorldPic, err := loadPicture(newWorld.BackgroundSprite)
+	if err != nil {
+		return err
+	}
+	// Safeguard against wacky maths
+	if newWorld.Scale <= 0.1 {
+		newWorld.Scale = 3
+	}
+
+	newWorld.Cars = world.Cars
+	world = newWorld
+	worldPic = newWorldPic
+	worldSprite = pixel.NewSprite(worldPic, worldPic.Bounds())
+	trackName = name
+	win.SetBounds(pixel.R(0, 0, world.Size.X*world.Scale, world.Size.Y*world.Scale))
+
+	resetCarPosition()
+	loadGhost()
+	return nil
+}
+
 func loadCar(slot int) error {
 	filename := getSaveFileName(slot)
-	return car.Load(filename)
+	err := car.Load(filename)
+	if err != nil {
+		return err
+	}
+	currentSlot = slot
+	// Laps driven by the previous design must not end up as the ghost of this one
+	resetCarPosition()
+	loadGhost()
+	return nil
+}
+
+func addTraffic(slot int) error {
+	traffic := &elcar.Car{}
+	err := traffic.Load(getSaveFileName(slot))
+	if err != nil {
+		return err
+	}
+	world.Cars = append(world.Cars, traffic)
+	resetCarPosition()
+	return nil
 }
 
 func saveCar(slot int) error {
 	filename := getSaveFileName(slot)
-	return car.Save(filename)
+	err := car.Save(filename)
+	if err != nil {
+		return err
+	}
+	// The ghost belongs to the car, not to the slot it was saved to before
+	currentSlot = slot
+	if ghost != nil {
+		return ghost.Save(getGhostFileName(slot))
+	}
+	// Don't leave the ghost of the design previously saved to this slot behind
+	err = os.Remove(getGhostFileName(slot))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
 }
 
 var saveEntries [5]SaveEntry
@@ -598,11 +902,12 @@ func runLevelEditTools(win *pixelgl.Window, dt float64) {
 }
 
 func drawHood(win *pixelgl.Window, dt float64) {
-	carHoodSprite.Draw(win, pixel.IM.Moved(carHoodSprite.Frame().Center()).Scaled(pixel.ZV, hoodScale))
+	hood := hoodSprite()
+	hood.Draw(win, pixel.IM.Moved(hood.Frame().Center()).Scaled(pixel.ZV, hoodScale))
 
 	imd := imdraw.New(nil)
 
-	for idx, port := range elcar.Definitions.Ports {
+	for idx, port := range car.Ports() {
 		var sprite *pixel.Sprite
 		switch port.PortKind {
 		case elcar.PortKindChip:
@@ -648,6 +953,14 @@ func drawHood(win *pixelgl.Window, dt float64) {
 			spritePinOut.Draw(win, pixel.IM.Moved(port.HoodPosition).Moved(pin.Position).Scaled(pixel.ZV, hoodScale))
 		}
 
+		if idx == editingComponentID {
+			imd.Clear()
+			imd.Color = colornames.Goldenrod
+			imd.Push(port.HoodPosition.Sub(pixel.V(9, 11)).Scaled(hoodScale), port.HoodPosition.Add(pixel.V(9, 11)).Scaled(hoodScale))
+			imd.Rectangle(2)
+			imd.Draw(win)
+		}
+
 		sprite = nil
 		sprite, ok = componentSprites[component.TypeName]
 		if !ok {
@@ -680,7 +993,7 @@ func drawHood(win *pixelgl.Window, dt float64) {
 	// Adjust to hood GUI scale
 	pos = pos.Scaled(1 / hoodScale)
 
-	for idx, port := range elcar.Definitions.Ports {
+	for idx, port := range car.Ports() {
 
 		if idx >= elcar.ComponentAny {
 
@@ -688,19 +1001,28 @@ func drawHood(win *pixelgl.Window, dt float64) {
 			if rect.Contains(pos) {
 
 				var tint color.Color
-				if selectingComponent != "" && !elcar.IsComponentAllowedInSlot(idx, selectingComponent) {
+				if selectingComponent != "" && !car.ChassisDefinition().IsComponentAllowedInSlot(idx, selectingComponent) {
 					tint = color.RGBA{R: 200, A: 40}
 				} else {
 					tint = color.Alpha{A: 70}
 				}
 				componentEmpty.DrawColorMask(win, pixel.IM.Moved(port.HoodPosition).Scaled(pixel.ZV, hoodScale), tint)
 
+				// Select component for editing its parameters
+				if win.JustReleased(pixelgl.MouseButtonRight) {
+					editingComponentID = -1
+					component := car.GetComponent(idx)
+					if len(elcar.Definitions.Components[component.TypeName].Parameters) > 0 {
+						editingComponentID = idx
+					}
+				}
+
 				// Change component
 				if mouseJustReleased {
 					if connectingFromState != NotConnecting {
 						connectingFromState = NotConnecting
 					} else if selectingComponent != "" {
-						if elcar.IsComponentAllowedInSlot(idx, selectingComponent) {
+						if car.ChassisDefinition().IsComponentAllowedInSlot(idx, selectingComponent) {
 							car.AddComponent(idx, selectingComponent)
 							selectingComponent = ""
 						}
@@ -735,7 +1057,7 @@ func drawHood(win *pixelgl.Window, dt float64) {
 
 				if mouseJustReleased {
 					if connectingFromState == ConnectingFromOutput {
-						car.ConnectPorts(connectingFromID, connectingFromPort, idx, i)
+						toggleConnection(connectingFromID, connectingFromPort, idx, i)
 						connectingFromState = NotConnecting
 					} else {
 						connectingFromState = ConnectingFromInput
@@ -770,7 +1092,7 @@ func drawHood(win *pixelgl.Window, dt float64) {
 
 				if mouseJustReleased {
 					if connectingFromState == ConnectingFromInput {
-						car.ConnectPorts(idx, i, connectingFromID, connectingFromPort)
+						toggleConnection(idx, i, connectingFromID, connectingFromPort)
 						connectingFromState = NotConnecting
 					} else {
 						connectingFromState = ConnectingFromOutput
@@ -794,19 +1116,90 @@ func drawHood(win *pixelgl.Window, dt float64) {
 	}
 }
 
+// drawParameterEditor shows the parameters of the component selected with a right click
+// and allows changing them with the buttons or the mouse wheel.
+func drawParameterEditor(win *pixelgl.Window, dt float64) {
+	component := car.GetComponent(editingComponentID)
+	def, ok := elcar.Definitions.Components[component.TypeName]
+	if !ok || len(def.Parameters) == 0 {
+		return
+	}
+
+	basePos := pixel.V(370, 256*hoodScale+180)
+	drawText(win, fontAtlas, def.Name+" (scroll or click to adjust, right click another chip to switch)", basePos.Add(pixel.V(0, 30)))
+
+	const rowHeight = 55
+	const rowsPerColumn = 3
+	const columnWidth = 460
+
+	for i, param := range def.Parameters {
+		pos := basePos.Add(pixel.V(float64(i/rowsPerColumn)*columnWidth, float64(-(i%rowsPerColumn)*rowHeight)))
+		value := component.Parameters[param.Name]
+		newValue := value
+
+		row := pixel.R(pos.X, pos.Y-rowHeight+5, pos.X+columnWidth-10, pos.Y)
+		if row.Contains(win.MousePosition()) {
+			newValue += win.MouseScroll().Y * param.Increment()
+		}
+
+		if drawMenuButton(win, fontAtlas, "-", pixel.R(pos.X, pos.Y-45, pos.X+45, pos.Y)) {
+			newValue -= param.Increment()
+		}
+		if drawMenuButton(win, fontAtlas, "+", pixel.R(pos.X+55, pos.Y-45, pos.X+100, pos.Y)) {
+			newValue += param.Increment()
+		}
+		drawText(win, fontAtlas, param.Name+": "+strconv.FormatFloat(value, 'g', 4, 64), pos.Add(pixel.V(115, -30)))
+
+		if newValue != value {
+			// Avoid accumulating rounding errors from repeated increments
+			newValue = math.Round(newValue/param.Increment()) * param.Increment()
+			car.SetParameter(editingComponentID, param.Name, newValue)
+		}
+	}
+}
+
+// toggleConnection wires an output pin to an input pin, or removes the wire if it already exists
+func toggleConnection(id, pin, targetID, targetPin int) {
+	if car.IsConnected(id, pin, targetID, targetPin) {
+		car.DisconnectPorts(id, pin, targetID, targetPin)
+	} else {
+		car.ConnectPorts(id, pin, targetID, targetPin)
+	}
+}
+
 func drawComponentSelector(win *pixelgl.Window, dt float64) {
-	componentBGSprite.Draw(win, pixel.IM.Moved(pixel.V(carHoodSprite.Frame().W(), 0)).Moved(componentBGSprite.Frame().Center()).Scaled(pixel.ZV, hoodScale))
+	hood := hoodSprite()
+	componentBGSprite.Draw(win, pixel.IM.Moved(pixel.V(hood.Frame().W(), 0)).Moved(componentBGSprite.Frame().Center()).Scaled(pixel.ZV, hoodScale))
 
-	basePos := pixel.V(carHoodSprite.Frame().H()+20, carHoodSprite.Frame().W()+-20)
+	basePos := pixel.V(hood.Frame().H()+20, hood.Frame().W()+-20)
+
+	panel := pixel.Rect{
+		Min: pixel.V(hood.Frame().W(), 0),
+		Max: pixel.V(hood.Frame().W(), 0).Add(componentBGSprite.Frame().Size()),
+	}
+	if panel.Contains(win.MousePosition().Scaled(1 / hoodScale)) {
+		componentListScroll -= win.MouseScroll().Y * 20
+	}
 
-	top := 0.0
+	top := componentListScroll
 
 	for _, typeName := range componentList {
 		def := elcar.Definitions.Components[typeName]
 		moveDown := 20.0
 
+		desc := strings.Split(def.Description, "\n")
+		if len(desc) > 1 {
+			moveDown += float64(len(desc)-1) * 5
+		}
+
 		singlePos := pixel.V(0, top)
 		rectCenter := basePos.Add(singlePos)
+		top -= moveDown
+
+		// Skip entries scrolled out of the panel
+		if rectCenter.Y > basePos.Y || rectCenter.Y-moveDown+10 < panel.Min.Y {
+			continue
+		}
 
 		sprite := componentSprites[typeName]
 		if sprite == nil {
@@ -830,16 +1223,16 @@ func drawComponentSelector(win *pixelgl.Window, dt float64) {
 		}
 
 		drawText(win, fontAtlas, def.Name, basePos.Add(singlePos).Add(pixel.V(14, 4)).Scaled(hoodScale))
-		desc := strings.Split(def.Description, "\n")
 		for i, line := range desc {
 			drawText(win, fontAtlas, line, basePos.Add(singlePos).Add(pixel.V(14, float64(-4+i*-5))).Scaled(hoodScale))
 		}
-		if len(desc) > 1 {
-			moveDown += float64(len(desc)-1) * 5
-		}
-		top -= moveDown
 	}
 
+	// Keep the list within the panel
+	listHeight := componentListScroll - top
+	maxScroll := math.Max(0, listHeight-(basePos.Y-panel.Min.Y))
+	componentListScroll = math.Max(0, math.Min(componentListScroll, maxScroll))
+
 	if win.JustPressed(pixelgl.MouseButtonRight) {
 		selectingComponent = ""
 	}
@@ -858,34 +1251,37 @@ func drawComponentConnections(win *pixelgl.Window, id int) {
 	if len(comp.ConnectedOutputs) == 0 {
 		return
 	}
-	if id < 0 || id >= len(elcar.Definitions.Ports) {
+	ports := car.Ports()
+	if id < 0 || id >= len(ports) {
 		return
 	}
 
-	pos := elcar.Definitions.Ports[id].HoodPosition
+	pos := ports[id].HoodPosition
 
-	for outPin, conn := range comp.ConnectedOutputs {
+	for outPin, destinations := range comp.ConnectedOutputs {
+		for _, conn := range destinations {
 
-		if conn.ID < 0 || conn.ID >= len(elcar.Definitions.Ports) {
-			continue
-		}
+			if conn.ID < 0 || conn.ID >= len(ports) {
+				continue
+			}
 
-		targetComponent := car.GetComponent(conn.ID)
-		if targetComponent.State == nil {
-			continue
-		}
+			targetComponent := car.GetComponent(conn.ID)
+			if targetComponent.State == nil {
+				continue
+			}
 
-		pinOffsetOut := elcar.GetOutPinPosition(comp.TypeName, outPin)
+			pinOffsetOut := elcar.GetOutPinPosition(comp.TypeName, outPin)
 
-		targetPos := elcar.Definitions.Ports[conn.ID].HoodPosition
+			targetPos := ports[conn.ID].HoodPosition
 
-		pinOffsetIn := elcar.GetInPinPosition(targetComponent.TypeName, conn.Pin)
+			pinOffsetIn := elcar.GetInPinPosition(targetComponent.TypeName, conn.Pin)
 
-		imd := imdraw.New(nil)
-		imd.Color = colornames.Red
-		imd.EndShape = imdraw.RoundEndShape
-		imd.Push(pos.Add(pinOffsetOut).Scaled(hoodScale), targetPos.Add(pinOffsetIn).Scaled(hoodScale))
-		imd.Line(5)
-		imd.Draw(win)
+			imd := imdraw.New(nil)
+			imd.Color = colornames.Red
+			imd.EndShape = imdraw.RoundEndShape
+			imd.Push(pos.Add(pinOffsetOut).Scaled(hoodScale), targetPos.Add(pinOffsetIn).Scaled(hoodScale))
+			imd.Line(5)
+			imd.Draw(win)
+		}
 	}
 }